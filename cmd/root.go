@@ -52,6 +52,9 @@ func Execute() {
 	case "auth key public":
 		err := runAuthKeyPublic(&cli.Auth.KeyCmd.PublicCmd)
 		ctx.FatalIfErrorf(err)
+	case "auth key jwks":
+		err := runAuthKeyJwks(&cli.Auth.KeyCmd.JwksCmd)
+		ctx.FatalIfErrorf(err)
 	case "auth jwt token":
 		err := runAuthJwtToken(&cli.Auth.JwtCmd.TokenCmd)
 		ctx.FatalIfErrorf(err)
@@ -93,6 +96,10 @@ func runAuthKeyPublic(conf *config.AuthKeyPublicCmd) error {
 	return jwtutil.GeneratePublicKey(conf)
 }
 
+func runAuthKeyJwks(conf *config.AuthKeyJwksCmd) error {
+	return jwtutil.GenerateJWKS(conf)
+}
+
 func runAuthJwtToken(conf *config.AuthJwtTokenCmd) error {
 	return jwtutil.GenerateJWTToken(conf)
 }
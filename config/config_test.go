@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthVerifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		conf       AuthVerifier
+		agentType  string
+		clientType string
+		wantErr    string
+	}{
+		{name: "noauth", conf: AuthVerifier{Type: AuthNoAuth}, agentType: AuthNoAuth, clientType: AuthNoAuth},
+		{name: "jwt", conf: AuthVerifier{Type: AuthJWT}, agentType: AuthJWT, clientType: AuthJWT},
+		{name: "mtls agents, jwt clients", conf: AuthVerifier{Type: AuthMTLS}, agentType: AuthMTLS, clientType: AuthJWT},
+		{name: "file clients, jwt agents", conf: AuthVerifier{Type: AuthFile}, agentType: AuthJWT, clientType: AuthFile},
+		{name: "explicit types", conf: AuthVerifier{Type: AuthFile, AgentType: AuthNoAuth, ClientType: AuthJWT}, agentType: AuthNoAuth, clientType: AuthJWT},
+		{name: "unsupported agent type", conf: AuthVerifier{Type: AuthJWT, AgentType: AuthOIDC}, wantErr: `--auth.agent-type must be one of [noauth jwt mtls] but got "oidc"`},
+		{name: "unsupported client type", conf: AuthVerifier{Type: AuthJWT, ClientType: "jtw"}, wantErr: `--auth.client-type must be one of [noauth jwt oidc file] but got "jtw"`},
+		{name: "oidc audience required", conf: AuthVerifier{Type: AuthOIDC}, wantErr: "--auth.oidc.audience is required"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.Validate()
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.agentType, tc.conf.GetAgentType())
+			require.Equal(t, tc.clientType, tc.conf.GetClientType())
+		})
+	}
+
+	oidc := AuthVerifier{Type: AuthOIDC}
+	oidc.OIDCVerifier.Audience = "reverse-http"
+	require.NoError(t, oidc.Validate())
+	require.Equal(t, AuthJWT, oidc.GetAgentType())
+}
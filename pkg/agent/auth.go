@@ -4,20 +4,34 @@ import (
 	"context"
 	"time"
 
-	"github.com/quic-go/quic-go"
+	"github.com/grepplabs/reverse-http/pkg/session"
 )
 
 const defaultTimeout = 3 * time.Second
 
 type Authenticator interface {
-	Authenticate(ctx context.Context, conn quic.Connection) error
+	Authenticate(ctx context.Context, conn session.Session) error
+}
+
+// Reauthenticator is implemented by authenticators, which refresh the credentials on the live connection.
+type Reauthenticator interface {
+	Reauthenticate(ctx context.Context, conn session.Session)
 }
 
 type Attributes struct {
-	AgentID string
-	Role    string
+	AgentID   string
+	Role      string
+	TokenID   string
+	ExpiresAt time.Time
+	// VerifiedAt is the time of the token verification, the session tickets keep it over the reconnects.
+	VerifiedAt time.Time
 }
 
 type Verifier interface {
-	Verify(ctx context.Context, conn quic.Connection) (*Attributes, error)
+	Verify(ctx context.Context, conn session.Session) (*Attributes, error)
+}
+
+// Reverifier is implemented by verifiers, which accept refreshed credentials on the live connection.
+type Reverifier interface {
+	Reverify(ctx context.Context, conn session.Session) (*Attributes, error)
 }
@@ -4,33 +4,126 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/grepplabs/reverse-http/config"
 	"github.com/grepplabs/reverse-http/pkg/jwtutil"
 	"github.com/grepplabs/reverse-http/pkg/logger"
-	"github.com/quic-go/quic-go"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/grepplabs/reverse-http/pkg/util"
 )
 
 type JWTAuthenticator struct {
 	authFlow *authFlow
-	token    string
+	token    atomic.Pointer[string]
+	ticket   atomic.Pointer[string]
+	watcher  *util.FileWatcher
+	refresh  time.Duration
+	logger   *logger.Logger
 }
 
 func NewJWTAuthenticator(token string) (Authenticator, error) {
 	if token == "" {
 		return nil, errors.New("jwt auth: empty token")
 	}
+	r := newJWTAuthenticator()
+	r.token.Store(&token)
+	return r, nil
+}
+
+// NewFileJWTAuthenticator reads the token from the file. The file is checked for changes within the refresh interval,
+// a changed token is used for re-authentication of the live connection.
+func NewFileJWTAuthenticator(filename string, refresh time.Duration) (Authenticator, error) {
+	r := newJWTAuthenticator()
+	r.refresh = refresh
+	r.watcher = util.NewFileWatcher(filename, r.setToken)
+	if err := r.watcher.Load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newJWTAuthenticator() *JWTAuthenticator {
 	return &JWTAuthenticator{
-		token: token,
 		authFlow: &authFlow{
 			timeout: defaultTimeout,
 			logger:  logger.GetInstance(),
 		},
-	}, nil
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "jwt-auth"}),
+	}
+}
+
+func (r *JWTAuthenticator) setToken(content []byte) error {
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return errors.New("jwt auth: empty token")
+	}
+	r.token.Store(&token)
+	return nil
+}
+
+func (r *JWTAuthenticator) Authenticate(ctx context.Context, conn session.Session) error {
+	var ticket string
+	if t := r.ticket.Load(); t != nil {
+		ticket = *t
+	}
+	if r.watcher != nil {
+		changed, err := r.watcher.Reload()
+		if err != nil {
+			r.logger.Warnf("token reload failed: %v", err)
+		}
+		if changed {
+			// the ticket was issued for the previous token
+			ticket = ""
+		}
+	}
+	response, err := r.authFlow.authenticate(ctx, conn, joinTicket(ticket, *r.token.Load()))
+	if err != nil {
+		return err
+	}
+	r.setTicket(response)
+	return nil
+}
+
+// setTicket keeps the session ticket issued by the proxy for the next connection.
+func (r *JWTAuthenticator) setTicket(response string) {
+	ticket, _ := splitTicket(response)
+	r.ticket.Store(&ticket)
 }
 
-func (r *JWTAuthenticator) Authenticate(ctx context.Context, conn quic.Connection) error {
-	return r.authFlow.authenticate(ctx, conn, r.token)
+// Reauthenticate sends the changed token file on the live connection until the context is done.
+func (r *JWTAuthenticator) Reauthenticate(ctx context.Context, conn session.Session) {
+	if r.watcher == nil || r.refresh <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.watcher.Reload()
+			if err != nil {
+				r.logger.Warnf("token reload failed: %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			r.logger.Info("token changed, re-authenticating")
+			// the ticket of the previous token is not sent, the proxy must verify the changed token
+			response, err := r.authFlow.authenticate(ctx, conn, *r.token.Load())
+			if err != nil {
+				r.logger.Error("re-authentication failed", slog.String("error", err.Error()))
+				continue
+			}
+			r.setTicket(response)
+		}
+	}
 }
 
 type JWTVerifier struct {
@@ -38,20 +131,37 @@ type JWTVerifier struct {
 	tokenVerifier jwtutil.TokenVerifier
 }
 
-func NewJWTVerifier(tokenVerifier jwtutil.TokenVerifier) Verifier {
-	return &JWTVerifier{
+type JWTVerifierOption func(*JWTVerifier)
+
+// WithJWTVerifierSessionTickets issues the session tickets, which skip the token verification on reconnect.
+func WithJWTVerifierSessionTickets(tickets *SessionTickets) JWTVerifierOption {
+	return func(r *JWTVerifier) {
+		r.authFlow.tickets = tickets
+	}
+}
+
+func NewJWTVerifier(tokenVerifier jwtutil.TokenVerifier, opts ...JWTVerifierOption) Verifier {
+	r := &JWTVerifier{
 		authFlow: &authFlow{
 			timeout: defaultTimeout,
 			logger:  logger.GetInstance(),
 		},
 		tokenVerifier: tokenVerifier,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func (r *JWTVerifier) Verify(ctx context.Context, conn quic.Connection) (*Attributes, error) {
+func (r *JWTVerifier) Verify(ctx context.Context, conn session.Session) (*Attributes, error) {
 	return r.authFlow.verify(ctx, conn, r.verifyToken)
 }
 
+func (r *JWTVerifier) Reverify(ctx context.Context, conn session.Session) (*Attributes, error) {
+	return r.authFlow.reverify(ctx, conn, r.verifyToken)
+}
+
 func (r *JWTVerifier) verifyToken(token string) (*Attributes, error) {
 	claims, err := r.tokenVerifier.VerifyToken(token)
 	if err != nil {
@@ -60,8 +170,13 @@ func (r *JWTVerifier) verifyToken(token string) (*Attributes, error) {
 	if claims.Role != config.RoleAgent {
 		return nil, fmt.Errorf("role mismatch: role %s vs claim %s", config.RoleAgent, claims.Role)
 	}
-	return &Attributes{
+	attrs := &Attributes{
 		AgentID: claims.AgentID,
 		Role:    claims.Role,
-	}, nil
+		TokenID: claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		attrs.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return attrs, nil
 }
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/grepplabs/reverse-http/pkg/util"
+)
+
+// MTLSAuthenticator relies on the client certificate presented during the TLS handshake.
+type MTLSAuthenticator struct{}
+
+func NewMTLSAuthenticator() Authenticator {
+	return &MTLSAuthenticator{}
+}
+
+func (r *MTLSAuthenticator) Authenticate(_ context.Context, _ session.Session) error {
+	return nil
+}
+
+// MTLSVerifier derives the agent ID from the verified client certificate, the token exchange is not used.
+type MTLSVerifier struct {
+	extractor *util.CertIdentityExtractor
+}
+
+func NewMTLSVerifier(extractor *util.CertIdentityExtractor) Verifier {
+	return &MTLSVerifier{
+		extractor: extractor,
+	}
+}
+
+func (r *MTLSVerifier) Verify(_ context.Context, conn session.Session) (*Attributes, error) {
+	state := conn.ConnectionState()
+	// the chain is verified by the TLS layer, no verified chains means the client CA is not configured
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil, errors.New("mtls: no verified client certificate")
+	}
+	leaf := state.PeerCertificates[0]
+	agentID, err := r.extractor.Identity(leaf)
+	if err != nil {
+		return nil, fmt.Errorf("mtls: %w", err)
+	}
+	return &Attributes{
+		AgentID:   agentID,
+		Role:      config.RoleAgent,
+		ExpiresAt: leaf.NotAfter,
+	}, nil
+}
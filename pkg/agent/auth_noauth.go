@@ -5,7 +5,7 @@ import (
 	"errors"
 
 	"github.com/grepplabs/reverse-http/config"
-	"github.com/quic-go/quic-go"
+	"github.com/grepplabs/reverse-http/pkg/session"
 )
 
 type NoAuthAuthenticator struct {
@@ -23,8 +23,9 @@ func NewNoAuthAuthenticator(agentID string) (Authenticator, error) {
 	}, nil
 }
 
-func (r *NoAuthAuthenticator) Authenticate(ctx context.Context, conn quic.Connection) error {
-	return r.authFlow.authenticate(ctx, conn, r.agentID)
+func (r *NoAuthAuthenticator) Authenticate(ctx context.Context, conn session.Session) error {
+	_, err := r.authFlow.authenticate(ctx, conn, r.agentID)
+	return err
 }
 
 type NoAuthVerifier struct {
@@ -37,7 +38,7 @@ func NewNoAuthVerifier() Verifier {
 	}
 }
 
-func (r *NoAuthVerifier) Verify(ctx context.Context, conn quic.Connection) (*Attributes, error) {
+func (r *NoAuthVerifier) Verify(ctx context.Context, conn session.Session) (*Attributes, error) {
 	return r.authFlow.verify(ctx, conn, r.verifyToken)
 }
 
@@ -9,7 +9,7 @@ import (
 	"time"
 
 	"github.com/grepplabs/reverse-http/pkg/logger"
-	"github.com/quic-go/quic-go"
+	"github.com/grepplabs/reverse-http/pkg/session"
 )
 
 const MaxAuthMessageLength = 1024 * 1024
@@ -17,32 +17,34 @@ const MaxAuthMessageLength = 1024 * 1024
 type authFlow struct {
 	timeout time.Duration
 	logger  *logger.Logger
+	tickets *SessionTickets
 }
 
-func (r *authFlow) authenticate(ctx context.Context, conn quic.Connection, token string) error {
+// authenticate sends the token and returns the verify response.
+func (r *authFlow) authenticate(ctx context.Context, conn session.Session, token string) (string, error) {
 	deadline := time.Now().Add(r.timeout)
 	ctx, cancel := context.WithDeadline(ctx, deadline)
 	defer cancel()
 
 	stream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
-		return fmt.Errorf("auth open failed: %v", err)
+		return "", fmt.Errorf("auth open failed: %v", err)
 	}
 	defer stream.Close()
 	_ = stream.SetDeadline(deadline)
 
 	err = writeString(stream, token)
 	if err != nil {
-		return fmt.Errorf("auth write failed: %v", err)
+		return "", fmt.Errorf("auth write failed: %v", err)
 	}
-	_, err = readString(stream)
+	response, err := readString(stream)
 	if err != nil {
-		return fmt.Errorf("auth read failed: %v", err)
+		return "", fmt.Errorf("auth read failed: %v", err)
 	}
-	return nil
+	return response, nil
 }
 
-func (r *authFlow) verify(ctx context.Context, conn quic.Connection, verifier func(token string) (*Attributes, error)) (*Attributes, error) {
+func (r *authFlow) verify(ctx context.Context, conn session.Session, verifier func(token string) (*Attributes, error)) (*Attributes, error) {
 	deadline := time.Now().Add(r.timeout)
 	ctx, cancel := context.WithDeadline(ctx, deadline)
 	defer cancel()
@@ -51,24 +53,69 @@ func (r *authFlow) verify(ctx context.Context, conn quic.Connection, verifier fu
 	if err != nil {
 		return nil, fmt.Errorf("verify accept failed: %v", err)
 	}
+	return r.verifyStream(stream, deadline, verifier)
+}
+
+// reverify waits for the re-authentication of the already verified connection.
+func (r *authFlow) reverify(ctx context.Context, conn session.Session, verifier func(token string) (*Attributes, error)) (*Attributes, error) {
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reverify accept failed: %v", err)
+	}
+	return r.verifyStream(stream, time.Now().Add(r.timeout), verifier)
+}
+
+func (r *authFlow) verifyStream(stream session.Stream, deadline time.Time, verifier func(token string) (*Attributes, error)) (*Attributes, error) {
 	defer stream.Close()
+	_ = stream.SetDeadline(deadline)
 
-	token, err := readString(stream)
+	message, err := readString(stream)
 	if err != nil {
 		return nil, fmt.Errorf("verify read failed: %v", err)
 	}
-	attrs, err := verifier(token)
-	if err != nil {
-		return nil, err
+	ticket, token := splitTicket(message)
+	attrs := r.verifyTicket(ticket)
+	if attrs == nil {
+		attrs, err = verifier(token)
+		if err != nil {
+			return nil, err
+		}
+		attrs.VerifiedAt = time.Now()
 	}
-	err = writeString(stream, "authenticated")
+	err = writeString(stream, r.issueTicket(attrs))
 	if err != nil {
 		return nil, fmt.Errorf("verify write failed: %v", err)
 	}
 	return attrs, nil
 }
 
-func writeString(stream quic.Stream, message string) error {
+// verifyTicket returns nil if the ticket is not valid, the token is verified instead.
+func (r *authFlow) verifyTicket(ticket string) *Attributes {
+	if ticket == "" || !r.tickets.Enabled() {
+		return nil
+	}
+	attrs, err := r.tickets.Verify(ticket)
+	if err != nil {
+		r.logger.Debug("session ticket rejected: " + err.Error())
+		return nil
+	}
+	return attrs
+}
+
+// issueTicket returns the verify response with the new session ticket.
+func (r *authFlow) issueTicket(attrs *Attributes) string {
+	if !r.tickets.Enabled() {
+		return authenticatedMessage
+	}
+	ticket, err := r.tickets.Issue(attrs)
+	if err != nil {
+		r.logger.Warn("session ticket issue failed: " + err.Error())
+		return authenticatedMessage
+	}
+	return ticketPrefix + ticket
+}
+
+func writeString(stream session.Stream, message string) error {
 	bs := []byte(message)
 	length := uint32(len(bs))
 	if length > MaxAuthMessageLength {
@@ -85,7 +132,7 @@ func writeString(stream quic.Stream, message string) error {
 	return err
 }
 
-func readString(stream quic.Stream) (string, error) {
+func readString(stream session.Stream) (string, error) {
 	var length uint32
 	err := binary.Read(stream, binary.BigEndian, &length)
 	if err != nil {
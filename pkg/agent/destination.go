@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/dns"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/util"
+)
+
+// destinationGuard resolves the destination and checks every resolved IP before the router dials it. The router
+// dials the returned IP, a rebinding between the check and the dial is not possible.
+type destinationGuard struct {
+	whitelist *util.Whitelist
+	denylist  *util.Whitelist
+	resolver  gost.Resolver
+	hosts     gost.HostMapper
+	logger    *logger.Logger
+}
+
+var _ gost.Resolver = (*destinationGuard)(nil)
+
+// newDestinationGuard returns the guard of the resolved destinations, nil when the resolve check is disabled. The
+// resolve check is enabled by the denylist and for the whitelist with the custom resolver or the hosts mapping. The
+// system resolver is used without the custom resolver.
+func newDestinationGuard(conf config.AgentDestination, whitelist *util.Whitelist, resolver gost.Resolver, hosts gost.HostMapper) *destinationGuard {
+	denylist := util.WhitelistFromStrings(conf.Denylist)
+	customResolution := whitelist != nil && (resolver != nil || hosts != nil)
+	if !conf.ResolveCheck && denylist == nil && !customResolution {
+		return nil
+	}
+	if resolver == nil {
+		resolver = dns.SystemResolver{}
+	}
+	return &destinationGuard{
+		whitelist: whitelist,
+		denylist:  denylist,
+		resolver:  resolver,
+		hosts:     hosts,
+		logger:    logger.GetInstance().WithFields(map[string]any{"kind": "destination"}),
+	}
+}
+
+// Resolve returns the addresses of the destination when all of them are allowed. The host matched by a whitelist
+// allow rule must not resolve to an IP denied by the denylist or the whitelist IP and network deny rules, other hosts
+// and the literal IPs must also match the whitelist networks.
+func (g *destinationGuard) Resolve(ctx context.Context, network, host string, opts ...gost.ResolverOption) ([]net.IP, error) {
+	options := gost.ResolverOptions{Port: -1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	ips, err := g.lookup(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	hostAllowed := g.whitelist == nil
+	if !hostAllowed && net.ParseIP(host) == nil {
+		if rule, ok := g.whitelist.Match(host, options.Port); ok {
+			if rule.Deny {
+				return nil, fmt.Errorf("%w: %s denied by rule %s", gost.ErrDestinationDenied, host, rule)
+			}
+			hostAllowed = true
+		}
+	}
+	for _, ip := range ips {
+		if g.denylist != nil && g.denylist.IsAddrAllowed(ip.String(), options.Port) {
+			return nil, fmt.Errorf("%w: %s resolved to denied address %s", gost.ErrDestinationDenied, host, ip)
+		}
+		if !hostAllowed && !g.whitelist.IsAddrAllowed(ip.String(), options.Port) {
+			return nil, fmt.Errorf("%w: %s resolved to address %s not in the whitelist", gost.ErrDestinationDenied, host, ip)
+		}
+		if hostAllowed && g.whitelist != nil {
+			if rule, ok := g.whitelist.MatchIP(ip, options.Port); ok && rule.Deny {
+				return nil, fmt.Errorf("%w: %s resolved to address %s denied by rule %s", gost.ErrDestinationDenied, host, ip, rule)
+			}
+		}
+	}
+	g.logger.Debugf("destination %s resolved to %v", host, ips)
+	return ips, nil
+}
+
+func (g *destinationGuard) lookup(ctx context.Context, network, host string) ([]net.IP, error) {
+	if g.hosts != nil {
+		if ips, ok := g.hosts.Lookup(ctx, network, host); ok {
+			return ips, nil
+		}
+	}
+	ips, err := g.resolver.Resolve(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("resolver: domain %s does not exist", host)
+	}
+	return ips, nil
+}
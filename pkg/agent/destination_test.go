@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/dns"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationGuard(t *testing.T) {
+	hosts, err := dns.ParseHosts(strings.NewReader(`
+93.184.216.34    app.example.com
+169.254.169.254  metadata.example.com
+169.254.169.254  metadata.attacker.example
+93.184.216.35    rebind.example.com
+127.0.0.1        rebind.example.com
+10.1.2.3         internal.corp
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		whitelist []string
+		denylist  []string
+		addr      string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "host pattern allowed",
+			whitelist: []string{"*.example.com"},
+			denylist:  []string{"169.254.0.0/16"},
+			addr:      "app.example.com:443",
+			want:      "93.184.216.34:443",
+		},
+		{
+			name:      "host pattern resolved to denied address",
+			whitelist: []string{"*.example.com"},
+			denylist:  []string{"169.254.0.0/16"},
+			addr:      "metadata.example.com:80",
+			wantErr:   "metadata.example.com resolved to denied address 169.254.169.254",
+		},
+		{
+			name:     "any resolved address denied",
+			denylist: []string{"127.0.0.0/8"},
+			addr:     "rebind.example.com:80",
+			wantErr:  "rebind.example.com resolved to denied address 127.0.0.1",
+		},
+		{
+			name:      "host resolved to whitelist network",
+			whitelist: []string{"10.0.0.0/8:443"},
+			addr:      "internal.corp:443",
+			want:      "10.1.2.3:443",
+		},
+		{
+			name:      "whitelist network port mismatch",
+			whitelist: []string{"10.0.0.0/8:443"},
+			addr:      "internal.corp:80",
+			wantErr:   "internal.corp resolved to address 10.1.2.3 not in the whitelist",
+		},
+		{
+			name:      "host not in whitelist",
+			whitelist: []string{"*.example.org"},
+			addr:      "app.example.com:443",
+			wantErr:   "app.example.com resolved to address 93.184.216.34 not in the whitelist",
+		},
+		{
+			name:     "literal ip denied",
+			denylist: []string{"169.254.169.254"},
+			addr:     "169.254.169.254:80",
+			wantErr:  "169.254.169.254 resolved to denied address 169.254.169.254",
+		},
+		{
+			name:      "host pattern resolved to whitelist deny rule",
+			whitelist: []string{"!169.254.0.0/16,*:443"},
+			addr:      "metadata.attacker.example:443",
+			wantErr:   "metadata.attacker.example resolved to address 169.254.169.254 denied by rule !169.254.0.0/16",
+		},
+		{
+			name:      "host pattern resolved to address after catch-all deny",
+			whitelist: []string{"*.example.com,!*"},
+			addr:      "app.example.com:443",
+			want:      "93.184.216.34:443",
+		},
+		{
+			name:      "host pattern resolved to address allowed before deny rule",
+			whitelist: []string{"10.0.0.0/8,!10.1.0.0/16,internal.corp"},
+			addr:      "internal.corp:22",
+			want:      "10.1.2.3:22",
+		},
+		{
+			name:      "literal ip in whitelist network",
+			whitelist: []string{"10.0.0.0/8"},
+			denylist:  []string{"10.9.0.0/16"},
+			addr:      "10.1.1.1:22",
+			want:      "10.1.1.1:22",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			guard := newDestinationGuard(config.AgentDestination{ResolveCheck: true, Denylist: tc.denylist}, util.WhitelistFromStrings(tc.whitelist), nil, hosts)
+			resolved, err := gost.Resolve(context.Background(), "ip", tc.addr, guard, nil, guard.logger)
+			if tc.wantErr != "" {
+				require.ErrorIs(t, err, gost.ErrDestinationDenied)
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, resolved)
+		})
+	}
+	require.Nil(t, newDestinationGuard(config.AgentDestination{}, util.WhitelistFromStrings([]string{"*.example.com"}), nil, nil))
+	require.Nil(t, newDestinationGuard(config.AgentDestination{}, nil, nil, hosts))
+}
+
+func TestDestinationGuardForbidden(t *testing.T) {
+	hosts, err := dns.ParseHosts(strings.NewReader("169.254.169.254 metadata.example.com\n"))
+	require.NoError(t, err)
+	guard := newDestinationGuard(config.AgentDestination{Denylist: []string{"169.254.0.0/16"}}, nil, nil, hosts)
+	router, err := newEgressRouter(config.AgentEgress{}, guard, nil)
+	require.NoError(t, err)
+	handler := httpProxyHandler(nil, config.TunnelLimits{}, router)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		_ = handler.Handle(context.Background(), server)
+		_ = server.Close()
+	}()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	req, err := http.NewRequest(http.MethodConnect, "http://metadata.example.com:80", nil)
+	require.NoError(t, err)
+	req.Host = "metadata.example.com:80"
+	require.NoError(t, req.Write(client))
+	resp, err := http.ReadResponse(bufio.NewReader(client), req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/dns"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+)
+
+// newNameResolution returns the custom resolver and the hosts mapping of the tunnel destinations, nil values use
+// the system resolver.
+func newNameResolution(conf config.AgentDNS) (gost.Resolver, gost.HostMapper, error) {
+	var resolver gost.Resolver
+	var hosts gost.HostMapper
+	if len(conf.Servers) != 0 {
+		r, err := dns.NewResolver(conf.Servers, dns.WithCacheTTL(conf.CacheTTL), dns.WithTimeout(conf.Timeout))
+		if err != nil {
+			return nil, nil, err
+		}
+		resolver = r
+	}
+	if conf.HostsFile != "" {
+		h, err := dns.LoadHostsFile(conf.HostsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		hosts = h
+	}
+	return resolver, hosts, nil
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/dns"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"github.com/stretchr/testify/require"
+)
+
+// rebindingResolver answers the addresses in turn, like a DNS server with a zero TTL rebinding the name.
+type rebindingResolver struct {
+	answers []net.IP
+	calls   atomic.Int32
+}
+
+func (r *rebindingResolver) Resolve(_ context.Context, _ string, host string, _ ...gost.ResolverOption) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if host != "rebind.corp.internal" {
+		return nil, errors.New("no such host")
+	}
+	n := int(r.calls.Add(1)) - 1
+	return []net.IP{r.answers[n%len(r.answers)]}, nil
+}
+
+func TestWhitelistResolvedDestination(t *testing.T) {
+	hosts, err := dns.ParseHosts(strings.NewReader("10.1.2.3 app.corp.internal\n192.0.2.10 public.example.com\n10.2.2.2 www.example.org\n"))
+	require.NoError(t, err)
+	resolver := &rebindingResolver{answers: []net.IP{net.ParseIP("10.9.9.9")}}
+	guard := newDestinationGuard(config.AgentDestination{}, util.WhitelistFromStrings([]string{"10.0.0.0/8:443", "*.example.org"}), resolver, hosts)
+	require.NotNil(t, guard)
+
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{addr: "app.corp.internal:443"},
+		{addr: "app.corp.internal:80", blocked: true},
+		{addr: "public.example.com:443", blocked: true},
+		{addr: "www.example.org:80"},
+		{addr: "10.9.9.9:443"},
+		{addr: "rebind.corp.internal:443"},
+		{addr: "unknown.corp.internal:443", blocked: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			_, err := gost.Resolve(context.Background(), "ip", tc.addr, guard, nil, guard.logger)
+			require.Equal(t, tc.blocked, err != nil, "unexpected result: %v", err)
+		})
+	}
+}
+
+func TestWhitelistResolvedDestinationRebinding(t *testing.T) {
+	echoAddr := newEchoServer(t)
+	_, echoPort, _ := net.SplitHostPort(echoAddr)
+	// the first answer is allowed, the following answers rebind the name to the metadata address
+	resolver := &rebindingResolver{answers: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("169.254.169.254")}}
+	guard := newDestinationGuard(config.AgentDestination{}, util.WhitelistFromStrings([]string{"127.0.0.0/8"}), resolver, nil)
+	require.NotNil(t, guard)
+	router, err := newEgressRouter(config.AgentEgress{}, guard, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := router.Dial(ctx, "tcp", net.JoinHostPort("rebind.corp.internal", echoPort))
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("rebind"))
+	require.NoError(t, err)
+	buf := make([]byte, len("rebind"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "rebind", string(buf))
+	require.Equal(t, echoAddr, conn.RemoteAddr().String())
+	require.Equal(t, int32(1), resolver.calls.Load())
+
+	// the rebound answer is rejected
+	_, err = router.Dial(ctx, "tcp", net.JoinHostPort("rebind.corp.internal", echoPort))
+	require.ErrorIs(t, err, gost.ErrDestinationDenied)
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/util"
+)
+
+// egressDirect is the chain name of the destinations dialed without proxy.
+const egressDirect = "direct"
+
+type egressRoute struct {
+	matcher *util.Whitelist
+	chain   *gost.Chain
+}
+
+// egressChainer selects the upstream proxy chain of the destination, nil chain dials the destination directly.
+type egressChainer struct {
+	routes       []egressRoute
+	defaultChain *gost.Chain
+	logger       *logger.Logger
+}
+
+// newEgressRouter returns the router dialing the tunnel destinations through the configured upstream proxy chains.
+// The destinations are resolved by the resolver and the hosts mapping when set.
+func newEgressRouter(conf config.AgentEgress, resolver gost.Resolver, hosts gost.HostMapper) (*gost.Router, error) {
+	chainer, err := newEgressChainer(conf)
+	if err != nil {
+		return nil, err
+	}
+	var routerOpts []gost.RouterOption
+	if chainer != nil {
+		routerOpts = append(routerOpts, gost.WithRouterChainer(chainer))
+	}
+	if resolver != nil {
+		routerOpts = append(routerOpts, gost.WithRouterResolver(resolver))
+	}
+	if hosts != nil {
+		routerOpts = append(routerOpts, gost.WithRouterHostMapper(hosts))
+	}
+	return gost.NewRouter(routerOpts...), nil
+}
+
+func newEgressChainer(conf config.AgentEgress) (*egressChainer, error) {
+	if len(conf.Chain) == 0 && len(conf.Route) == 0 && (conf.Default == "" || conf.Default == egressDirect) {
+		return nil, nil
+	}
+	chains := map[string]*gost.Chain{egressDirect: nil}
+	for name, urls := range conf.Chain {
+		if name == egressDirect {
+			return nil, fmt.Errorf("egress chain name %s is reserved", egressDirect)
+		}
+		chain, err := newEgressChain(name, urls, conf.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		chains[name] = chain
+	}
+	lookup := func(name string) (*gost.Chain, error) {
+		chain, ok := chains[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown egress chain: %s", name)
+		}
+		return chain, nil
+	}
+	c := &egressChainer{
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "egress"}),
+	}
+	for _, route := range conf.Route {
+		idx := strings.LastIndex(route, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid egress route %q, expected PATTERN=CHAIN", route)
+		}
+		pattern := strings.TrimSpace(route[:idx])
+		chain, err := lookup(strings.TrimSpace(route[idx+1:]))
+		if err != nil {
+			return nil, err
+		}
+		matcher := util.NewWhitelist()
+		matcher.AddFromString(pattern)
+		c.routes = append(c.routes, egressRoute{matcher: matcher, chain: chain})
+	}
+	defaultName := conf.Default
+	if defaultName == "" {
+		defaultName = egressDirect
+	}
+	defaultChain, err := lookup(defaultName)
+	if err != nil {
+		return nil, err
+	}
+	c.defaultChain = defaultChain
+	return c, nil
+}
+
+// newEgressChain creates the chain of the upstream proxies from the comma separated proxy URLs.
+func newEgressChain(name string, urls string, timeout time.Duration) (*gost.Chain, error) {
+	chain := gost.NewChain(name)
+	for i, rawURL := range strings.Split(urls, ",") {
+		proxyURL, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil {
+			return nil, fmt.Errorf("egress chain %s: %w", name, err)
+		}
+		var connectorOpts []gost.ConnectorOption
+		if proxyURL.User != nil {
+			connectorOpts = append(connectorOpts, gost.WithConnectorAuth(gost.NewStaticConnectorAuth(proxyURL.User)))
+		}
+		if timeout > 0 {
+			connectorOpts = append(connectorOpts, gost.WithConnectorConnectTimeout(timeout))
+		}
+		var connector gost.Connector
+		var defaultPort int
+		switch proxyURL.Scheme {
+		case "http":
+			connector = gost.NewHttpConnector(connectorOpts...)
+			defaultPort = 80
+		case "socks5", "socks5h":
+			connector = gost.NewSocks5Connector(connectorOpts...)
+			defaultPort = 1080
+		default:
+			return nil, fmt.Errorf("egress chain %s: unsupported proxy scheme %q", name, proxyURL.Scheme)
+		}
+		if proxyURL.Hostname() == "" {
+			return nil, fmt.Errorf("egress chain %s: missing proxy host in %s", name, proxyURL.Redacted())
+		}
+		port := proxyURL.Port()
+		if port == "" {
+			port = strconv.Itoa(defaultPort)
+		}
+		addr := net.JoinHostPort(proxyURL.Hostname(), port)
+		tr := gost.NewTransport(gost.NewTcpDialer(), connector,
+			gost.WithTransportAddr(addr),
+			gost.WithTransportTimeout(timeout),
+		)
+		chain.AddNode(gost.NewNode(fmt.Sprintf("%s-%d", name, i), addr, gost.WithNodeTransport(tr)))
+	}
+	return chain, nil
+}
+
+// Route returns the route of the first matching destination rule. The router passes the destination host in the
+// options, the address is resolved when the router has a resolver.
+func (c *egressChainer) Route(ctx context.Context, network, address string, opts ...gost.ChainerOption) gost.Route {
+	var options gost.ChainerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	destination := options.Host
+	if destination == "" {
+		destination = address
+	}
+	chain := c.defaultChain
+	if host, port, err := net.SplitHostPort(destination); err == nil {
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			portNum = -1
+		}
+		for _, route := range c.routes {
+			if route.matcher.IsAddrAllowed(host, portNum) {
+				chain = route.chain
+				break
+			}
+		}
+	}
+	c.logger.Debugf("egress %s via %s", destination, chainName(chain))
+	return chain.Route(ctx, network, address, opts...)
+}
+
+func chainName(chain *gost.Chain) string {
+	if chain == nil {
+		return egressDirect
+	}
+	return chain.Name()
+}
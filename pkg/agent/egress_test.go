@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/stretchr/testify/require"
+)
+
+// upstreamProxy is the HTTP CONNECT or SOCKS5 proxy stand-in, it records the requested destinations.
+type upstreamProxy struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	requests []string
+}
+
+func newUpstreamProxy(t *testing.T, serve func(p *upstreamProxy, conn net.Conn)) *upstreamProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &upstreamProxy{ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(p, conn)
+		}
+	}()
+	return p
+}
+
+func (p *upstreamProxy) addr() string {
+	return p.ln.Addr().String()
+}
+
+func (p *upstreamProxy) record(destination string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, destination)
+}
+
+func (p *upstreamProxy) destinations() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func pipe(conn net.Conn, destination string) {
+	upstream, err := net.Dial("tcp", destination)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func serveHttpConnect(p *upstreamProxy, conn net.Conn) {
+	defer conn.Close()
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+	// Basic dXNlcjpzZWNyZXQ= is user:secret
+	if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+		_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+	p.record(req.Host)
+	_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	pipe(conn, req.Host)
+}
+
+// serveSocks5 handles the no-auth CONNECT requests with IPv4 and domain addresses.
+func serveSocks5(p *upstreamProxy, conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 0})
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return
+		}
+		host = string(domain)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	destination := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.record(destination)
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	pipe(conn, destination)
+}
+
+func newEchoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestEgressRouter(t *testing.T) {
+	httpProxy := newUpstreamProxy(t, serveHttpConnect)
+	socksProxy := newUpstreamProxy(t, serveSocks5)
+	echoAddr := newEchoServer(t)
+	_, echoPort, _ := net.SplitHostPort(echoAddr)
+	localhostAddr := net.JoinHostPort("localhost", echoPort)
+
+	tests := []struct {
+		name        string
+		conf        config.AgentEgress
+		destination string
+		wantHttp    []string
+		wantSocks   []string
+		wantErr     string
+	}{
+		{
+			name:        "direct without config",
+			destination: echoAddr,
+		},
+		{
+			name: "default chain",
+			conf: config.AgentEgress{
+				Chain:   map[string]string{"corp": "http://user:secret@" + httpProxy.addr()},
+				Default: "corp",
+			},
+			destination: echoAddr,
+			wantHttp:    []string{echoAddr},
+		},
+		{
+			name: "first matching route",
+			conf: config.AgentEgress{
+				Chain: map[string]string{
+					"corp":  "http://user:secret@" + httpProxy.addr(),
+					"socks": "socks5://" + socksProxy.addr(),
+				},
+				Route:   []string{"localhost:" + echoPort + "=socks", "localhost=corp"},
+				Default: "direct",
+			},
+			destination: localhostAddr,
+			wantSocks:   []string{localhostAddr},
+		},
+		{
+			name: "direct route",
+			conf: config.AgentEgress{
+				Chain:   map[string]string{"corp": "http://user:secret@" + httpProxy.addr()},
+				Route:   []string{"127.0.0.0/8=direct"},
+				Default: "corp",
+			},
+			destination: echoAddr,
+		},
+		{
+			name: "proxy chain",
+			conf: config.AgentEgress{
+				Chain:   map[string]string{"corp": "http://user:secret@" + httpProxy.addr() + ",socks5://" + socksProxy.addr()},
+				Default: "corp",
+			},
+			destination: localhostAddr,
+			wantHttp:    []string{socksProxy.addr()},
+			wantSocks:   []string{localhostAddr},
+		},
+		{
+			name: "proxy authentication required",
+			conf: config.AgentEgress{
+				Chain:   map[string]string{"corp": "http://" + httpProxy.addr()},
+				Default: "corp",
+			},
+			destination: echoAddr,
+			wantErr:     "407 Proxy Authentication Required",
+		},
+		{
+			name: "unknown chain",
+			conf: config.AgentEgress{
+				Route: []string{"*.corp.internal=corp"},
+			},
+			wantErr: "unknown egress chain: corp",
+		},
+		{
+			name: "unsupported scheme",
+			conf: config.AgentEgress{
+				Chain: map[string]string{"corp": "ftp://" + httpProxy.addr()},
+			},
+			wantErr: `unsupported proxy scheme "ftp"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			httpBefore := len(httpProxy.destinations())
+			socksBefore := len(socksProxy.destinations())
+
+			router, err := newEgressRouter(tc.conf, nil, nil)
+			if err == nil {
+				var conn net.Conn
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				conn, err = router.Dial(ctx, "tcp", tc.destination)
+				if err == nil {
+					defer conn.Close()
+					_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+					_, err = conn.Write([]byte("egress"))
+					require.NoError(t, err)
+					buf := make([]byte, len("egress"))
+					_, err = io.ReadFull(conn, buf)
+					require.NoError(t, err)
+					require.Equal(t, "egress", string(buf))
+				}
+			}
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantHttp, nilIfEmpty(httpProxy.destinations()[httpBefore:]))
+			require.Equal(t, tc.wantSocks, nilIfEmpty(socksProxy.destinations()[socksBefore:]))
+		})
+	}
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/session"
+)
+
+// drainCheckInterval is the interval of the active stream checks of the draining connection.
+const drainCheckInterval = time.Second
+
+// routeLocalIP returns the local address selected by the OS to reach the remote address. Connecting the UDP socket
+// does not send any packets.
+func routeLocalIP(remote net.Addr) (net.IP, error) {
+	var udpAddr *net.UDPAddr
+	switch addr := remote.(type) {
+	case *net.UDPAddr:
+		udpAddr = addr
+	case *net.TCPAddr:
+		udpAddr = &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	default:
+		return nil, fmt.Errorf("unsupported remote address %s", remote)
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	localAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, errors.New("unsupported local address")
+	}
+	return localAddr.IP, nil
+}
+
+// awaitPathChange returns a new connection when the local address used to reach the proxy changes. The QUIC
+// connection is bound to the local address, the new path is used by a new connection before the old one is closed.
+// The error is returned when the connection is done.
+func (c *QuickClient) awaitPathChange(conn session.Session, done <-chan error) (session.Session, error) {
+	var checks <-chan time.Time
+	if c.pathConfig.CheckInterval > 0 {
+		ticker := time.NewTicker(c.pathConfig.CheckInterval)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+	localIP, err := c.localIP(conn.RemoteAddr())
+	if err != nil {
+		c.logger.Warn("local address check failed", slog.String("error", err.Error()))
+	}
+	for {
+		select {
+		case err = <-done:
+			return nil, err
+		case <-checks:
+			ip, err := c.localIP(conn.RemoteAddr())
+			if err != nil {
+				// no route e.g. the interface is down, the connection may recover
+				c.logger.Debug("local address check failed: " + err.Error())
+				continue
+			}
+			if localIP == nil {
+				localIP = ip
+				continue
+			}
+			if ip.Equal(localIP) {
+				continue
+			}
+			c.logger.Info(fmt.Sprintf("local address changed from %s to %s, connecting over the new path", localIP, ip))
+			newConn, err := c.connect()
+			if err != nil {
+				c.logger.Error("new path connect failure", slog.String("error", err.Error()))
+				continue
+			}
+			return newConn, nil
+		}
+	}
+}
+
+// drain closes the connection replaced by the new path after the active streams are finished or the drain timeout.
+// The proxy opens new streams on the new connection.
+func (c *QuickClient) drain(conn session.Session, active *atomic.Int64, done <-chan error) {
+	c.logger.Info(fmt.Sprintf("draining connection from %s with %d active streams", conn.LocalAddr(), active.Load()))
+	timeout := time.NewTimer(c.pathConfig.DrainTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for active.Load() > 0 {
+		select {
+		case <-done:
+			return
+		case <-timeout.C:
+			c.logger.Info(fmt.Sprintf("drain timeout, closing connection with %d active streams", active.Load()))
+			_ = conn.CloseWithError(0, "path changed")
+			return
+		case <-ticker.C:
+		}
+	}
+	_ = conn.CloseWithError(0, "path changed")
+}
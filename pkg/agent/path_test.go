@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+// udpRebinder forwards the datagrams between the clients and the server. Rebind switches the upstream sockets,
+// the server sees new source addresses like after a NAT rebinding. The old sockets still forward the replies.
+type udpRebinder struct {
+	conn   *net.UDPConn
+	server *net.UDPAddr
+
+	mu        sync.Mutex
+	upstreams map[string]*net.UDPConn
+	sockets   []*net.UDPConn
+}
+
+func newUDPRebinder(t *testing.T, server *net.UDPAddr) *udpRebinder {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	r := &udpRebinder{conn: conn, server: server, upstreams: make(map[string]*net.UDPConn)}
+	t.Cleanup(r.close)
+	go r.run()
+	return r
+}
+
+func (r *udpRebinder) addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+func (r *udpRebinder) run() {
+	buf := make([]byte, 65535)
+	for {
+		n, client, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		upstream, err := r.upstream(client)
+		if err != nil {
+			return
+		}
+		_, _ = upstream.Write(buf[:n])
+	}
+}
+
+func (r *udpRebinder) upstream(client *net.UDPAddr) (*net.UDPConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if upstream, ok := r.upstreams[client.String()]; ok {
+		return upstream, nil
+	}
+	return r.bind(client)
+}
+
+func (r *udpRebinder) bind(client *net.UDPAddr) (*net.UDPConn, error) {
+	upstream, err := net.DialUDP("udp", nil, r.server)
+	if err != nil {
+		return nil, err
+	}
+	r.upstreams[client.String()] = upstream
+	r.sockets = append(r.sockets, upstream)
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := upstream.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = r.conn.WriteToUDP(buf[:n], client)
+		}
+	}()
+	return upstream, nil
+}
+
+func (r *udpRebinder) rebind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for client := range r.upstreams {
+		addr, _ := net.ResolveUDPAddr("udp", client)
+		_, _ = r.bind(addr)
+	}
+}
+
+func (r *udpRebinder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.conn.Close()
+	for _, socket := range r.sockets {
+		_ = socket.Close()
+	}
+}
+
+type echoHandler struct{}
+
+func (echoHandler) Handle(_ context.Context, conn net.Conn, _ ...gost.HandleOption) error {
+	_, err := io.Copy(conn, conn)
+	return err
+}
+
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{config.ReverseHttpProto},
+	}
+}
+
+func echo(t *testing.T, stream quic.Stream, message string) {
+	_ = stream.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := stream.Write([]byte(message))
+	require.NoError(t, err)
+	buf := make([]byte, len(message))
+	_, err = io.ReadFull(stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, message, string(buf))
+}
+
+func TestQuickClientPathChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := quic.ListenAddr("127.0.0.1:0", selfSignedTLSConfig(t), &quic.Config{KeepAlivePeriod: 100 * time.Millisecond})
+	require.NoError(t, err)
+	defer ln.Close()
+	conns := make(chan quic.Connection, 4)
+	go func() {
+		verifier := NewNoAuthVerifier()
+		for {
+			conn, err := ln.Accept(ctx)
+			if err != nil {
+				return
+			}
+			if _, err = verifier.Verify(ctx, session.NewQuic(conn)); err == nil {
+				conns <- conn
+			}
+		}
+	}()
+	rebinder := newUDPRebinder(t, ln.Addr().(*net.UDPAddr))
+
+	var localIP atomic.Pointer[net.IP]
+	ip1 := net.IPv4(192, 0, 2, 10)
+	localIP.Store(&ip1)
+	authenticator, err := NewNoAuthAuthenticator("4711")
+	require.NoError(t, err)
+	client := &QuickClient{
+		parent:        ctx,
+		address:       rebinder.addr(),
+		proxyHandler:  echoHandler{},
+		authenticator: authenticator,
+		logger:        logger.GetInstance(),
+		tlsConfigFunc: func() *tls.Config {
+			return &tls.Config{InsecureSkipVerify: true, NextProtos: []string{config.ReverseHttpProto}}
+		},
+		quicConfig: &quic.Config{KeepAlivePeriod: 100 * time.Millisecond},
+		pathConfig: config.AgentPath{CheckInterval: 20 * time.Millisecond, DrainTimeout: 5 * time.Second},
+		localIP: func(net.Addr) (net.IP, error) {
+			return *localIP.Load(), nil
+		},
+	}
+	go func() {
+		_ = client.connectForHttpProxy()
+	}()
+
+	var conn1 quic.Connection
+	select {
+	case conn1 = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent connection timeout")
+	}
+	tunnel, err := conn1.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	echo(t, tunnel, "before rebinding")
+
+	// NAT rebinding: the connection survives while the old mapping forwards the replies
+	rebinder.rebind()
+	echo(t, tunnel, "after rebinding")
+
+	// the local address changes: the agent connects over the new path
+	ip2 := net.IPv4(198, 51, 100, 20)
+	localIP.Store(&ip2)
+	var conn2 quic.Connection
+	select {
+	case conn2 = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new path connection timeout")
+	}
+	require.NotEqual(t, conn1.RemoteAddr().String(), conn2.RemoteAddr().String())
+
+	// the active tunnel of the old connection is drained
+	echo(t, tunnel, "while draining")
+	require.NoError(t, conn1.Context().Err())
+	require.NoError(t, tunnel.Close())
+	select {
+	case <-conn1.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("drained connection was not closed")
+	}
+
+	newTunnel, err := conn2.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	echo(t, newTunnel, "new path")
+	require.NoError(t, conn2.Context().Err())
+}
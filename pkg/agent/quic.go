@@ -2,10 +2,15 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"net"
+	"net/http"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	tlsconfig "github.com/grepplabs/cert-source/config"
@@ -14,6 +19,7 @@ import (
 	"github.com/grepplabs/reverse-http/config"
 	"github.com/grepplabs/reverse-http/pkg/gost"
 	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/session"
 	"github.com/grepplabs/reverse-http/pkg/util"
 	"github.com/oklog/run"
 	"github.com/quic-go/quic-go"
@@ -44,7 +50,11 @@ func addAgentClient(conf *config.AgentCmd, group *run.Group) {
 		if err != nil {
 			return err
 		}
-		client, err := NewQuickClient(ctx, conf.AgentClient.ServerAddress, authenticator, log, conf.AgentClient.HostWhitelist, conf.AgentClient.TLS)
+		hostWhitelist, err := getHostWhitelist(ctx, conf)
+		if err != nil {
+			return err
+		}
+		client, err := NewQuickClient(ctx, conf.AgentClient.ServerAddress, authenticator, log, hostWhitelist, conf.AgentClient.TLS, conf.AgentClient.Tunnel, conf.AgentClient.Quic, conf.AgentClient.Path, conf.AgentClient.Transport, conf.AgentClient.Egress, conf.AgentClient.DNS, conf.AgentClient.Destination)
 		if err != nil {
 			return err
 		}
@@ -55,64 +65,118 @@ func addAgentClient(conf *config.AgentCmd, group *run.Group) {
 	})
 }
 
+// getHostWhitelist returns the whitelist of the patterns, the whitelist file rules follow the patterns and are
+// reloaded on changes until the context is done.
+func getHostWhitelist(ctx context.Context, conf *config.AgentCmd) (*util.Whitelist, error) {
+	fileConf := conf.AgentClient.HostWhitelistFile
+	if fileConf.File == "" {
+		return util.WhitelistFromStrings(conf.AgentClient.HostWhitelist), nil
+	}
+	whitelistFile, err := util.NewWhitelistFile(fileConf.File, conf.AgentClient.HostWhitelist)
+	if err != nil {
+		return nil, err
+	}
+	go whitelistFile.Watch(ctx, fileConf.Refresh)
+	return whitelistFile.Whitelist(), nil
+}
+
 func getAuthenticator(conf *config.AgentCmd) (Authenticator, error) {
 	switch conf.Auth.Type {
 	case config.AuthNoAuth:
 		return NewNoAuthAuthenticator(conf.Auth.NoAuth.AgentID)
 	case config.AuthJWT:
-		token, err := getJWTToken(conf)
-		if err != nil {
-			return nil, fmt.Errorf("get jwt token failed: %v", err)
+		token := conf.Auth.JWTAuth.Token
+		if strings.HasPrefix(token, config.TokenFromFilePrefix) {
+			filename := strings.TrimPrefix(token, config.TokenFromFilePrefix)
+			authenticator, err := NewFileJWTAuthenticator(filename, conf.Auth.JWTAuth.Refresh)
+			if err != nil {
+				return nil, fmt.Errorf("get jwt token failed: %v", err)
+			}
+			return authenticator, nil
 		}
 		return NewJWTAuthenticator(token)
+	case config.AuthMTLS:
+		if conf.AgentClient.TLS.File.Cert == "" || conf.AgentClient.TLS.File.Key == "" {
+			return nil, errors.New("mtls auth requires agent client TLS certificate and key")
+		}
+		return NewMTLSAuthenticator(), nil
 	default:
 		return nil, fmt.Errorf("unsupported auth type: %s", conf.Auth.Type)
 	}
 }
 
-func getJWTToken(conf *config.AgentCmd) (string, error) {
-	token := conf.Auth.JWTAuth.Token
-
-	if strings.HasPrefix(token, config.TokenFromFilePrefix) {
-		filename := strings.TrimLeft(token, config.TokenFromFilePrefix)
-		content, err := os.ReadFile(filename)
-		if err != nil {
-			return "", err
-		}
-		return string(content), nil
-	}
-	return token, nil
-}
-
 type QuickClient struct {
-	parent        context.Context
-	address       string
-	proxyHandler  gost.Handler
-	authenticator Authenticator
-	logger        *logger.Logger
-	tlsConfigFunc tlsclient.TLSClientConfigFunc
+	parent          context.Context
+	address         string
+	proxyHandler    gost.Handler
+	authenticator   Authenticator
+	logger          *logger.Logger
+	tlsConfigFunc   tlsclient.TLSClientConfigFunc
+	quicConfig      *quic.Config
+	pathConfig      config.AgentPath
+	transportConfig config.AgentTransport
+	httpProxy       session.ProxyFunc
+	localIP         func(remote net.Addr) (net.IP, error)
 }
 
-func NewQuickClient(parent context.Context, address string, authenticator Authenticator, logger *logger.Logger, whitelist []string, tlsClientConfig config.TLSClientConfig) (*QuickClient, error) {
+func NewQuickClient(parent context.Context, address string, authenticator Authenticator, logger *logger.Logger, hostWhitelist *util.Whitelist, tlsClientConfig config.TLSClientConfig, tunnelLimits config.TunnelLimits, quicConf config.QuicConfig, pathConf config.AgentPath, transportConf config.AgentTransport, egressConf config.AgentEgress, dnsConf config.AgentDNS, destinationConf config.AgentDestination) (*QuickClient, error) {
 	tlsConfigFunc, err := tlsclientconfig.GetTLSClientConfigFunc(logger.Logger, &tlsconfig.TLSClientConfig{
 		Enable:             true,
 		Refresh:            tlsClientConfig.Refresh,
 		InsecureSkipVerify: tlsClientConfig.InsecureSkipVerify,
 		File:               tlsClientConfig.File,
-	}, tlsclient.WithTLSClientNextProtos([]string{config.ReverseHttpProto}))
+	}, tlsclient.WithTLSClientNextProtos([]string{config.ReverseHttpProto}), withTLSClientSessionCache(tls.NewLRUClientSessionCache(0)))
+	if err != nil {
+		return nil, err
+	}
+	httpProxy, err := httpProxyFunc(transportConf.HTTPProxy)
+	if err != nil {
+		return nil, err
+	}
+	resolver, hosts, err := newNameResolution(dnsConf)
+	if err != nil {
+		return nil, err
+	}
+	var bypass gost.Bypass
+	if hostWhitelist != nil {
+		bypass = hostWhitelist
+	}
+	if guard := newDestinationGuard(destinationConf, hostWhitelist, resolver, hosts); guard != nil {
+		// the guard checks the whitelist with the resolved addresses and resolves the mapped hosts, the router
+		// dials the checked addresses
+		resolver, hosts, bypass = guard, nil, nil
+	}
+	router, err := newEgressRouter(egressConf, resolver, hosts)
 	if err != nil {
 		return nil, err
 	}
 	return &QuickClient{
-		parent:        parent,
-		address:       address,
-		proxyHandler:  httpProxyHandler(util.WhitelistFromStrings(whitelist)),
-		authenticator: authenticator,
-		logger:        logger,
-		tlsConfigFunc: tlsConfigFunc,
+		parent:          parent,
+		address:         address,
+		proxyHandler:    httpProxyHandler(bypass, tunnelLimits, router),
+		authenticator:   authenticator,
+		logger:          logger,
+		tlsConfigFunc:   tlsConfigFunc,
+		quicConfig:      util.NewQuicConfig(quicConf),
+		pathConfig:      pathConf,
+		transportConfig: transportConf,
+		httpProxy:       httpProxy,
+		localIP:         routeLocalIP,
 	}, nil
 }
 
+// httpProxyFunc returns the configured HTTP proxy of the WebSocket transport, the default is taken from the environment.
+func httpProxyFunc(httpProxy string) (session.ProxyFunc, error) {
+	if httpProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(httpProxy)
+	if err != nil {
+		return nil, fmt.Errorf("http proxy: %w", err)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
 func (c *QuickClient) keepConnected() {
 	err := c.connectForHttpProxy()
 	if err != nil {
@@ -133,43 +197,141 @@ func (c *QuickClient) keepConnected() {
 	}
 }
 
+// withTLSClientSessionCache keeps the TLS sessions for the resumption and 0-RTT of the reconnects.
+func withTLSClientSessionCache(cache tls.ClientSessionCache) tlsclient.TLSClientConfigOption {
+	return func(c *tls.Config) {
+		c.ClientSessionCache = cache
+	}
+}
+
+// dial connects to the proxy over QUIC, the auto transport falls back to TCP or WebSocket when QUIC fails e.g. UDP
+// is blocked.
+func (c *QuickClient) dial(tlsConf *tls.Config) (session.Session, error) {
+	switch c.transportConfig.Type {
+	case config.TransportTCP:
+		return c.dialTCP(tlsConf)
+	case config.TransportWebSocket:
+		return c.dialWebSocket(tlsConf)
+	case config.TransportAuto:
+		ctx, cancel := context.WithTimeout(c.parent, c.transportConfig.QuicTimeout)
+		defer cancel()
+		sess, err := c.dialQuic(ctx, tlsConf)
+		if err == nil || c.parent.Err() != nil {
+			return sess, err
+		}
+		if c.transportConfig.WebSocketURL != "" {
+			c.logger.Warn("quic connect failed, falling back to websocket", slog.String("error", err.Error()))
+			return c.dialWebSocket(tlsConf)
+		}
+		c.logger.Warn("quic connect failed, falling back to tcp", slog.String("error", err.Error()))
+		return c.dialTCP(tlsConf)
+	default:
+		return c.dialQuic(c.parent, tlsConf)
+	}
+}
+
+// dialQuic connects over QUIC, with 0-RTT the connection is usable before the handshake completes.
+func (c *QuickClient) dialQuic(ctx context.Context, tlsConf *tls.Config) (session.Session, error) {
+	var conn quic.Connection
+	var err error
+	if c.quicConfig.Allow0RTT {
+		conn, err = quic.DialAddrEarly(ctx, c.address, tlsConf, c.quicConfig)
+	} else {
+		conn, err = quic.DialAddr(ctx, c.address, tlsConf, c.quicConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session.NewQuic(conn), nil
+}
+
+// dialTCP connects over TLS, the streams are multiplexed over the connection.
+func (c *QuickClient) dialTCP(tlsConf *tls.Config) (session.Session, error) {
+	address := c.transportConfig.TCPAddress
+	if address == "" {
+		address = c.address
+	}
+	return session.DialTCP(c.parent, address, tlsConf, c.muxConfig())
+}
+
+// dialWebSocket connects over wss://, through the HTTP proxy when configured. The streams are multiplexed over
+// the WebSocket.
+func (c *QuickClient) dialWebSocket(tlsConf *tls.Config) (session.Session, error) {
+	if c.transportConfig.WebSocketURL == "" {
+		return nil, errors.New("websocket transport requires the websocket url")
+	}
+	return session.DialWebSocket(c.parent, c.transportConfig.WebSocketURL, c.httpProxy, tlsConf, c.muxConfig())
+}
+
+func (c *QuickClient) muxConfig() session.MuxConfig {
+	return session.MuxConfig{
+		KeepAlivePeriod:  c.quicConfig.KeepAlivePeriod,
+		HandshakeTimeout: c.quicConfig.HandshakeIdleTimeout,
+	}
+}
+
 func (c *QuickClient) connectForHttpProxy() error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	for {
+		active := new(atomic.Int64)
+		done := make(chan error, 1)
+		go func(conn session.Session) {
+			done <- c.serve(conn, active)
+		}(conn)
+		newConn, err := c.awaitPathChange(conn, done)
+		if err != nil {
+			_ = conn.CloseWithError(0, "client connection closed")
+			return err
+		}
+		go c.drain(conn, active, done)
+		conn = newConn
+	}
+}
+
+// connect dials and authenticates the connection to the proxy.
+func (c *QuickClient) connect() (session.Session, error) {
 	c.logger.Info("connecting to " + c.address)
 
 	tlsConf := c.tlsConfigFunc()
-	conn, err := quic.DialAddr(c.parent, c.address, tlsConf, &quic.Config{
-		KeepAlivePeriod: config.DefaultKeepAlivePeriod,
-	})
+	conn, err := c.dial(tlsConf)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer conn.CloseWithError(0, "client connection closed")
-
-	c.logger.Info("sending authenticate")
+	c.logger.Info(fmt.Sprintf("connected over %s to %s, sending authenticate", conn.Transport(), conn.RemoteAddr()))
 	err = c.authenticator.Authenticate(c.parent, conn)
 	if err != nil {
-		return err
+		_ = conn.CloseWithError(0, "client connection closed")
+		return nil, err
+	}
+	if reauthenticator, ok := c.authenticator.(Reauthenticator); ok {
+		go reauthenticator.Reauthenticate(conn.Context(), conn)
 	}
+	return conn, nil
+}
+
+// serve handles the streams opened by the proxy until the connection is closed.
+func (c *QuickClient) serve(conn session.Session, active *atomic.Int64) error {
 	for {
 		c.logger.Info("waiting for clients")
 		stream, err := conn.AcceptStream(c.parent)
 		if err != nil {
 			return fmt.Errorf("stream accept failure: %v", err)
 		}
-		log := c.logger.With(slog.Int64("stream", int64(stream.StreamID())))
+		log := c.logger.With(slog.Int64("stream", session.StreamID(stream)))
 		log.Info("stream accepted")
 
+		active.Add(1)
 		go func() {
 			defer func() {
 				_ = stream.Close()
+				active.Add(-1)
 				log.Info("stream closed")
 			}()
 
-			err := c.proxyHandler.Handle(c.parent, &util.QuicConn{
-				Stream: stream,
-				LAddr:  conn.LocalAddr(),
-				RAddr:  conn.RemoteAddr(),
-			})
+			err := c.proxyHandler.Handle(c.parent, stream)
 			if err != nil {
 				log.Error("serve conn failure", slog.String("error", err.Error()))
 			}
@@ -177,10 +339,14 @@ func (c *QuickClient) connectForHttpProxy() error {
 	}
 }
 
-func httpProxyHandler(bypass *util.Whitelist) gost.Handler {
-	router := gost.NewRouter()
+func httpProxyHandler(bypass gost.Bypass, limits config.TunnelLimits, router *gost.Router) gost.Handler {
 	httpHandlerOpts := []gost.HandlerOption{
 		gost.WithHandlerRouter(router),
+		gost.WithHandlerTransportLimits(gost.TransportLimits{
+			IdleTimeout: limits.IdleTimeout,
+			MaxDuration: limits.MaxDuration,
+			MaxBytes:    limits.MaxBytes,
+		}),
 	}
 	if bypass != nil {
 		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerBypass(bypass))
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/config"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickClientFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		config    func(addr string) config.AgentTransport
+	}{
+		{
+			name:      "tcp",
+			transport: session.TransportTCP,
+			config: func(addr string) config.AgentTransport {
+				return config.AgentTransport{TCPAddress: addr}
+			},
+		},
+		{
+			name:      "websocket",
+			transport: session.TransportWebSocket,
+			config: func(addr string) config.AgentTransport {
+				return config.AgentTransport{TCPAddress: "127.0.0.1:1", WebSocketURL: "wss://" + addr + "/agent"}
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// UDP is "blocked": nothing answers on the QUIC address
+			blocked, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			require.NoError(t, err)
+			defer blocked.Close()
+
+			tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			var ln session.Listener
+			if tc.transport == session.TransportWebSocket {
+				ln = session.NewWebSocketListener(tcpLn, "/agent", selfSignedTLSConfig(t), session.MuxConfig{})
+			} else {
+				ln = session.NewTCPListener(tcpLn, selfSignedTLSConfig(t), session.MuxConfig{})
+			}
+			defer ln.Close()
+			sessions := make(chan session.Session, 1)
+			go func() {
+				verifier := NewNoAuthVerifier()
+				for {
+					sess, err := ln.Accept(ctx)
+					if err != nil {
+						return
+					}
+					if _, err = verifier.Verify(ctx, sess); err == nil {
+						sessions <- sess
+					}
+				}
+			}()
+
+			transportConfig := tc.config(tcpLn.Addr().String())
+			transportConfig.Type = config.TransportAuto
+			transportConfig.QuicTimeout = 200 * time.Millisecond
+			authenticator, err := NewNoAuthAuthenticator("4711")
+			require.NoError(t, err)
+			client := &QuickClient{
+				parent:        ctx,
+				address:       blocked.LocalAddr().String(),
+				proxyHandler:  echoHandler{},
+				authenticator: authenticator,
+				logger:        logger.GetInstance(),
+				tlsConfigFunc: func() *tls.Config {
+					return &tls.Config{InsecureSkipVerify: true, NextProtos: []string{config.ReverseHttpProto}}
+				},
+				quicConfig:      &quic.Config{},
+				transportConfig: transportConfig,
+				localIP:         routeLocalIP,
+			}
+			go func() {
+				_ = client.connectForHttpProxy()
+			}()
+
+			var sess session.Session
+			select {
+			case sess = <-sessions:
+			case <-time.After(5 * time.Second):
+				t.Fatal("agent fallback timeout")
+			}
+			require.Equal(t, tc.transport, sess.Transport())
+
+			tunnel, err := sess.OpenStreamSync(ctx)
+			require.NoError(t, err)
+			_ = tunnel.SetDeadline(time.Now().Add(5 * time.Second))
+			_, err = tunnel.Write([]byte("over " + tc.name))
+			require.NoError(t, err)
+			buf := make([]byte, len("over "+tc.name))
+			_, err = io.ReadFull(tunnel, buf)
+			require.NoError(t, err)
+			require.Equal(t, "over "+tc.name, string(buf))
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/revocation"
+)
+
+const (
+	// minSessionTicketSecretLength is the minimal length of the session ticket secret in bytes.
+	minSessionTicketSecretLength = 32
+	// ticketPrefix marks the session ticket in the auth messages.
+	ticketPrefix = "ticket:"
+	// authenticatedMessage is the verify response without session ticket.
+	authenticatedMessage = "authenticated"
+	ticketVersion        = "v1"
+)
+
+var errInvalidTicket = errors.New("invalid session ticket")
+
+type ticketClaims struct {
+	AgentID        string `json:"aid"`
+	Role           string `json:"role"`
+	TokenID        string `json:"jti,omitempty"`
+	TokenExpiresAt int64  `json:"texp,omitempty"`
+	AuthTime       int64  `json:"auth_time"`
+	ExpiresAt      int64  `json:"exp"`
+}
+
+type SessionTicketsOption func(*SessionTickets)
+
+// WithSessionTicketsRevocationList rejects the tickets issued for revoked tokens.
+func WithSessionTicketsRevocationList(revocationList revocation.List) SessionTicketsOption {
+	return func(t *SessionTickets) {
+		t.revocationList = revocationList
+	}
+}
+
+// SessionTickets issues the agent session tickets after a successful token verification. A reconnecting agent
+// presents the ticket, which skips the token verification until the ticket expires. The secret is shared by
+// the proxies, so the tickets remain valid after a proxy restart.
+type SessionTickets struct {
+	secret         []byte
+	ticketKey      []byte
+	ttl            time.Duration
+	revocationList revocation.List
+}
+
+// LoadSessionTicketSecret reads the secret from the file.
+func LoadSessionTicketSecret(filename string) ([]byte, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("session ticket secret: %w", err)
+	}
+	secret := []byte(strings.TrimSpace(string(content)))
+	if len(secret) < minSessionTicketSecretLength {
+		return nil, fmt.Errorf("session ticket secret: at least %d bytes are required", minSessionTicketSecretLength)
+	}
+	return secret, nil
+}
+
+func NewSessionTickets(secret []byte, ttl time.Duration, opts ...SessionTicketsOption) (*SessionTickets, error) {
+	if len(secret) < minSessionTicketSecretLength {
+		return nil, fmt.Errorf("session ticket secret: at least %d bytes are required", minSessionTicketSecretLength)
+	}
+	t := &SessionTickets{
+		secret:    secret,
+		ticketKey: deriveKey(secret, "reverse-http agent session ticket"),
+		ttl:       ttl,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+// TLSSessionTicketKey returns the key for the TLS session tickets, which allows the TLS resumption and 0-RTT
+// of the agent connections after a proxy restart.
+func (t *SessionTickets) TLSSessionTicketKey() [32]byte {
+	var key [32]byte
+	copy(key[:], deriveKey(t.secret, "reverse-http tls session ticket"))
+	return key
+}
+
+func deriveKey(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// Enabled returns true if the agent session tickets are issued.
+func (t *SessionTickets) Enabled() bool {
+	return t != nil && t.ttl > 0
+}
+
+// Issue creates the ticket, which expires after the TTL from the token verification but not later than the token.
+// The tickets issued for a ticket do not extend the expiry, the token is verified again after the TTL.
+func (t *SessionTickets) Issue(attrs *Attributes) (string, error) {
+	verifiedAt := attrs.VerifiedAt
+	if verifiedAt.IsZero() {
+		verifiedAt = time.Now()
+	}
+	expiresAt := verifiedAt.Add(t.ttl)
+	if !attrs.ExpiresAt.IsZero() && attrs.ExpiresAt.Before(expiresAt) {
+		expiresAt = attrs.ExpiresAt
+	}
+	claims := ticketClaims{
+		AgentID:   attrs.AgentID,
+		Role:      attrs.Role,
+		TokenID:   attrs.TokenID,
+		AuthTime:  verifiedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+	if !attrs.ExpiresAt.IsZero() {
+		claims.TokenExpiresAt = attrs.ExpiresAt.Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := ticketVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(t.sign(encoded)), nil
+}
+
+// Verify returns the attributes of the verified token, for which the ticket was issued.
+func (t *SessionTickets) Verify(ticket string) (*Attributes, error) {
+	parts := strings.Split(ticket, ".")
+	if len(parts) != 3 || parts[0] != ticketVersion {
+		return nil, errInvalidTicket
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0]+"."+parts[1])) {
+		return nil, errInvalidTicket
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidTicket
+	}
+	var claims ticketClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidTicket
+	}
+	if claims.AuthTime == 0 {
+		return nil, errInvalidTicket
+	}
+	if time.Now().After(time.Unix(claims.ExpiresAt, 0)) || time.Now().After(time.Unix(claims.AuthTime, 0).Add(t.ttl)) {
+		return nil, errors.New("session ticket expired")
+	}
+	if t.revocationList != nil && claims.TokenID != "" && t.revocationList.IsRevoked(claims.TokenID) {
+		return nil, errors.New("session ticket token revoked")
+	}
+	attrs := &Attributes{
+		AgentID:    claims.AgentID,
+		Role:       claims.Role,
+		TokenID:    claims.TokenID,
+		VerifiedAt: time.Unix(claims.AuthTime, 0),
+	}
+	if claims.TokenExpiresAt != 0 {
+		attrs.ExpiresAt = time.Unix(claims.TokenExpiresAt, 0)
+	}
+	return attrs, nil
+}
+
+func (t *SessionTickets) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, t.ticketKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// joinTicket prepends the ticket to the auth message.
+func joinTicket(ticket, message string) string {
+	if ticket == "" {
+		return message
+	}
+	return ticketPrefix + ticket + "\n" + message
+}
+
+// splitTicket returns the ticket and the auth message.
+func splitTicket(message string) (string, string) {
+	if !strings.HasPrefix(message, ticketPrefix) {
+		return "", message
+	}
+	ticket, rest, _ := strings.Cut(strings.TrimPrefix(message, ticketPrefix), "\n")
+	return ticket, rest
+}
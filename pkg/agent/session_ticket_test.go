@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+type revokedIDs map[string]bool
+
+func (r revokedIDs) IsRevoked(tokenID string) bool {
+	return r[tokenID]
+}
+
+func TestSessionTickets(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	tickets, err := NewSessionTickets(secret, time.Minute, WithSessionTicketsRevocationList(revokedIDs{"revoked": true}))
+	require.NoError(t, err)
+
+	tokenExpiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	verifiedAt := time.Now().Truncate(time.Second)
+	ticket, err := tickets.Issue(&Attributes{AgentID: "4711", Role: "agent", TokenID: "jti-1", ExpiresAt: tokenExpiresAt, VerifiedAt: verifiedAt})
+	require.NoError(t, err)
+
+	attrs, err := tickets.Verify(ticket)
+	require.NoError(t, err)
+	require.Equal(t, "4711", attrs.AgentID)
+	require.Equal(t, "agent", attrs.Role)
+	require.Equal(t, "jti-1", attrs.TokenID)
+	require.True(t, tokenExpiresAt.Equal(attrs.ExpiresAt))
+	require.True(t, verifiedAt.Equal(attrs.VerifiedAt))
+
+	// the same secret verifies the tickets after a restart
+	restarted, err := NewSessionTickets(secret, time.Minute)
+	require.NoError(t, err)
+	_, err = restarted.Verify(ticket)
+	require.NoError(t, err)
+	require.Equal(t, tickets.TLSSessionTicketKey(), restarted.TLSSessionTicketKey())
+
+	other, err := NewSessionTickets([]byte("fedcba9876543210fedcba9876543210"), time.Minute)
+	require.NoError(t, err)
+	_, err = other.Verify(ticket)
+	require.ErrorIs(t, err, errInvalidTicket)
+	require.NotEqual(t, tickets.TLSSessionTicketKey(), other.TLSSessionTicketKey())
+
+	_, err = tickets.Verify(ticket[:len(ticket)-2] + "xx")
+	require.ErrorIs(t, err, errInvalidTicket)
+
+	// the ticket does not outlive the token
+	expired, err := tickets.Issue(&Attributes{AgentID: "4711", Role: "agent", ExpiresAt: time.Now().Add(-time.Second)})
+	require.NoError(t, err)
+	_, err = tickets.Verify(expired)
+	require.ErrorContains(t, err, "expired")
+
+	revoked, err := tickets.Issue(&Attributes{AgentID: "4711", Role: "agent", TokenID: "revoked"})
+	require.NoError(t, err)
+	_, err = tickets.Verify(revoked)
+	require.ErrorContains(t, err, "revoked")
+
+	_, err = NewSessionTickets([]byte("short"), time.Minute)
+	require.Error(t, err)
+}
+
+func TestSessionTicketsChaining(t *testing.T) {
+	tickets, err := NewSessionTickets([]byte("0123456789abcdef0123456789abcdef"), time.Minute)
+	require.NoError(t, err)
+	flow := &authFlow{tickets: tickets, logger: logger.GetInstance()}
+
+	// the token without exp was verified 50s ago
+	verifiedAt := time.Now().Add(-50 * time.Second).Truncate(time.Second)
+	ticket, err := tickets.Issue(&Attributes{AgentID: "4711", Role: "agent", VerifiedAt: verifiedAt})
+	require.NoError(t, err)
+
+	// the reconnects with the ticket get the tickets expiring with the first one
+	for i := 0; i < 3; i++ {
+		attrs := flow.verifyTicket(ticket)
+		require.NotNil(t, attrs)
+		require.True(t, verifiedAt.Equal(attrs.VerifiedAt))
+		ticket = strings.TrimPrefix(flow.issueTicket(attrs), ticketPrefix)
+		require.Equal(t, verifiedAt.Add(time.Minute).Unix(), decodeTicketClaims(t, ticket).ExpiresAt)
+	}
+
+	// after the TTL from the verification the token must be verified again
+	stale, err := tickets.Issue(&Attributes{AgentID: "4711", Role: "agent", VerifiedAt: time.Now().Add(-2 * time.Minute)})
+	require.NoError(t, err)
+	require.Nil(t, flow.verifyTicket(stale))
+
+	// the tickets without the verification time are rejected
+	legacy := signTicketClaims(tickets, ticketClaims{AgentID: "4711", Role: "agent", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	_, err = tickets.Verify(legacy)
+	require.ErrorIs(t, err, errInvalidTicket)
+}
+
+func decodeTicketClaims(t *testing.T, ticket string) ticketClaims {
+	parts := strings.Split(ticket, ".")
+	require.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims ticketClaims
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func signTicketClaims(tickets *SessionTickets, claims ticketClaims) string {
+	payload, _ := json.Marshal(claims)
+	encoded := ticketVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(tickets.sign(encoded))
+}
+
+func TestSplitTicket(t *testing.T) {
+	tests := []struct {
+		message string
+		ticket  string
+		token   string
+	}{
+		{message: "eyJhbGciOi.e30.sig", token: "eyJhbGciOi.e30.sig"},
+		{message: joinTicket("v1.payload.sig", "eyJhbGciOi.e30.sig"), ticket: "v1.payload.sig", token: "eyJhbGciOi.e30.sig"},
+		{message: joinTicket("", "eyJhbGciOi.e30.sig"), token: "eyJhbGciOi.e30.sig"},
+		{message: ticketPrefix + "v1.payload.sig", ticket: "v1.payload.sig"},
+		{message: authenticatedMessage, token: authenticatedMessage},
+	}
+	for _, tc := range tests {
+		ticket, token := splitTicket(tc.message)
+		require.Equal(t, tc.ticket, ticket)
+		require.Equal(t, tc.token, token)
+	}
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+)
+
+// Logger writes the audit records as JSON lines.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	logger *logger.Logger
+}
+
+// NewLogger writes the records to the writer.
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{
+		w:      w,
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "audit"}),
+	}
+}
+
+// NewFileLogger appends the records to the file, '-' writes to stdout.
+func NewFileLogger(filename string) (*Logger, error) {
+	if filename == "-" {
+		return NewLogger(os.Stdout), nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := NewLogger(f)
+	l.closer = f
+	return l, nil
+}
+
+func (l *Logger) Audit(record *gost.AuditRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		l.logger.Error("audit record marshal failure", slog.String("error", err.Error()))
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.w.Write(data); err != nil {
+		l.logger.Error("audit record write failure", slog.String("error", err.Error()))
+	}
+}
+
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closer == nil {
+		return nil
+	}
+	err := l.closer.Close()
+	l.closer = nil
+	return err
+}
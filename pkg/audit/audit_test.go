@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLogger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	l, err := NewFileLogger(filename)
+	require.NoError(t, err)
+
+	l.Audit(&gost.AuditRecord{
+		Time:        time.Now(),
+		Subject:     "alice",
+		AgentID:     "4711",
+		SourceIP:    "10.0.0.1",
+		Network:     "tcp",
+		Destination: "httpbin.org:443",
+		Decision:    gost.AuditAllowed,
+		BytesUp:     100,
+		BytesDown:   2000,
+		Duration:    time.Second,
+	})
+	l.Audit(&gost.AuditRecord{
+		Time:        time.Now(),
+		User:        "4711",
+		Network:     "tcp",
+		Destination: "httpbin.org:443",
+		Decision:    gost.AuditAuthFailed,
+	})
+	require.NoError(t, l.Close())
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	require.Equal(t, "alice", records[0]["subject"])
+	require.Equal(t, "allowed", records[0]["decision"])
+	require.Equal(t, float64(2000), records[0]["bytes_down"])
+	require.Equal(t, "auth-failed", records[1]["decision"])
+	require.Equal(t, "4711", records[1]["user"])
+}
@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+)
+
+// Hosts is the static host mapping in the hosts file format: IP address, canonical name and aliases per line.
+type Hosts struct {
+	entries map[string][]net.IP
+}
+
+var _ gost.HostMapper = (*Hosts)(nil)
+
+// LoadHostsFile reads the hosts file e.g. /etc/hosts.
+func LoadHostsFile(filename string) (*Hosts, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("hosts file: %w", err)
+	}
+	defer file.Close()
+	hosts, err := ParseHosts(file)
+	if err != nil {
+		return nil, fmt.Errorf("hosts file %s: %w", filename, err)
+	}
+	return hosts, nil
+}
+
+// ParseHosts parses the hosts file format, the comments start with #.
+func ParseHosts(r io.Reader) (*Hosts, error) {
+	hosts := &Hosts{entries: make(map[string][]net.IP)}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("line %d: invalid IP address %q", lineNum, fields[0])
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing host name", lineNum)
+		}
+		for _, name := range fields[1:] {
+			key := hostKey(name)
+			hosts.entries[key] = append(hosts.entries[key], ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// Lookup returns the mapped addresses of the network: ip4, ip6 or both.
+func (h *Hosts) Lookup(_ context.Context, network, host string, _ ...gost.HostsOption) ([]net.IP, bool) {
+	if h == nil {
+		return nil, false
+	}
+	var ips []net.IP
+	for _, ip := range h.entries[hostKey(host)] {
+		switch network {
+		case "ip4", "tcp4", "udp4":
+			if ip.To4() == nil {
+				continue
+			}
+		case "ip6", "tcp6", "udp6":
+			if ip.To4() != nil {
+				continue
+			}
+		}
+		ips = append(ips, ip)
+	}
+	return ips, len(ips) > 0
+}
+
+// Len returns the number of the mapped host names.
+func (h *Hosts) Len() int {
+	return len(h.entries)
+}
+
+func hostKey(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
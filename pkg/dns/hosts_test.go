@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHosts(t *testing.T) {
+	hosts, err := ParseHosts(strings.NewReader(`
+# split horizon
+10.1.2.3     app.corp.internal app   # alias
+2001:db8::1  app.corp.internal
+10.1.2.4     DB.corp.internal.
+`))
+	require.NoError(t, err)
+	require.Equal(t, 3, hosts.Len())
+
+	tests := []struct {
+		network string
+		host    string
+		want    []string
+	}{
+		{network: "ip", host: "app.corp.internal", want: []string{"10.1.2.3", "2001:db8::1"}},
+		{network: "ip4", host: "app", want: []string{"10.1.2.3"}},
+		{network: "ip6", host: "app.corp.internal.", want: []string{"2001:db8::1"}},
+		{network: "ip", host: "db.corp.internal", want: []string{"10.1.2.4"}},
+		{network: "ip6", host: "db.corp.internal"},
+		{network: "ip", host: "missing.corp.internal"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.network+"/"+tc.host, func(t *testing.T) {
+			ips, ok := hosts.Lookup(context.Background(), tc.network, tc.host)
+			require.Equal(t, len(tc.want) > 0, ok)
+			var got []string
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadHostsFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(filename, []byte("10.1.2.3 app\nnot-an-ip app\n"), 0o600))
+	_, err := LoadHostsFile(filename)
+	require.ErrorContains(t, err, `line 2: invalid IP address "not-an-ip"`)
+
+	_, err = LoadHostsFile(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
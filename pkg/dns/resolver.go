@@ -0,0 +1,497 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	// maxCacheEntries bounds the cache, the expired entries are removed when the bound is reached.
+	maxCacheEntries = 4096
+	// udpPayloadSize is the EDNS(0) UDP payload size, larger responses are truncated and retried over TCP.
+	udpPayloadSize = 1232
+	dnsMessageType = "application/dns-message"
+)
+
+var errNoSuchHost = errors.New("no such host")
+
+type options struct {
+	timeout   time.Duration
+	cacheTTL  time.Duration
+	tlsConfig *tls.Config
+	logger    *logger.Logger
+}
+
+type Option func(*options)
+
+// WithTimeout sets the timeout of the exchange with a name server.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithCacheTTL sets the maximum time the answers are cached, the record TTLs are used when lower. Zero disables the cache.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithTLSConfig sets the TLS config of the DoT and DoH name servers e.g. with a private CA.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+func WithLogger(logger *logger.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// nameserver is the DNS server address with the protocol: udp, tcp, tls (DoT) or https (DoH).
+type nameserver struct {
+	protocol string
+	addr     string
+	url      string
+}
+
+func (ns nameserver) String() string {
+	if ns.protocol == "https" {
+		return ns.url
+	}
+	return ns.protocol + "://" + ns.addr
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// Resolver resolves the hosts with the configured name servers, the servers are tried in order.
+type Resolver struct {
+	servers    []nameserver
+	options    options
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+var _ gost.Resolver = (*Resolver)(nil)
+
+// NewResolver creates the resolver of the name servers e.g. 10.0.0.2, udp://10.0.0.2:53, tcp://10.0.0.2:53,
+// tls://1.1.1.1:853 or https://1.1.1.1/dns-query.
+func NewResolver(servers []string, opts ...Option) (*Resolver, error) {
+	r := &Resolver{
+		options: options{
+			timeout: defaultTimeout,
+			logger:  logger.GetInstance().WithFields(map[string]any{"kind": "resolver"}),
+		},
+		cache: make(map[string]cacheEntry),
+	}
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("resolver: no name servers")
+	}
+	for _, server := range servers {
+		ns, err := parseNameserver(server)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, ns)
+	}
+	r.httpClient = &http.Client{
+		Timeout:   r.options.timeout,
+		Transport: &http.Transport{TLSClientConfig: r.tlsConfig(""), ForceAttemptHTTP2: true},
+	}
+	return r, nil
+}
+
+func (r *Resolver) tlsConfig(serverName string) *tls.Config {
+	var tlsConfig *tls.Config
+	if r.options.tlsConfig != nil {
+		tlsConfig = r.options.tlsConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = serverName
+	}
+	return tlsConfig
+}
+
+func parseNameserver(server string) (nameserver, error) {
+	server = strings.TrimSpace(server)
+	if !strings.Contains(server, "://") {
+		server = "udp://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nameserver{}, fmt.Errorf("resolver: name server %s: %w", server, err)
+	}
+	if u.Hostname() == "" {
+		return nameserver{}, fmt.Errorf("resolver: name server %s: missing host", server)
+	}
+	var defaultPort string
+	switch u.Scheme {
+	case "udp", "tcp":
+		defaultPort = "53"
+	case "tls":
+		defaultPort = "853"
+	case "https":
+		return nameserver{protocol: u.Scheme, url: u.String()}, nil
+	default:
+		return nameserver{}, fmt.Errorf("resolver: name server %s: unsupported protocol %q", server, u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return nameserver{protocol: u.Scheme, addr: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// Resolve returns the IPv4 addresses before the IPv6 addresses for the network ip.
+func (r *Resolver) Resolve(ctx context.Context, network, host string, _ ...gost.ResolverOption) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	var types []dnsmessage.Type
+	switch network {
+	case "ip4", "tcp4", "udp4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6", "tcp6", "udp6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	}
+	key := network + "/" + strings.ToLower(host)
+	if ips, ok := r.cached(key); ok {
+		return ips, nil
+	}
+
+	// a failed query type does not discard the addresses of the other one, the partial answer is not cached
+	var ips []net.IP
+	var lookupErr error
+	ttl := r.options.cacheTTL
+	for _, qtype := range types {
+		answer, answerTTL, err := r.lookup(ctx, host, qtype)
+		if err != nil && !errors.Is(err, errNoSuchHost) {
+			r.options.logger.Warnf("lookup %s %s failed: %v", host, qtype, err)
+			lookupErr = err
+			continue
+		}
+		ips = append(ips, answer...)
+		if len(answer) > 0 && answerTTL < ttl {
+			ttl = answerTTL
+		}
+	}
+	if len(ips) == 0 {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return nil, fmt.Errorf("resolver: %s: %w", host, errNoSuchHost)
+	}
+	if lookupErr == nil {
+		r.store(key, ips, ttl)
+	}
+	return ips, nil
+}
+
+// lookup queries the name servers in order, the first answer is returned.
+func (r *Resolver) lookup(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, 0, fmt.Errorf("resolver: %s: %w", host, err)
+	}
+	var errs []error
+	for _, ns := range r.servers {
+		ips, ttl, err := r.query(ctx, ns, name, qtype)
+		if err == nil || errors.Is(err, errNoSuchHost) {
+			return ips, ttl, err
+		}
+		r.options.logger.Debugf("query %s %s to %s failed: %v", host, qtype, ns, err)
+		errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+	}
+	return nil, 0, fmt.Errorf("resolver: %s: %w", host, errors.Join(errs...))
+}
+
+func (r *Resolver) query(ctx context.Context, ns nameserver, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.options.timeout)
+	defer cancel()
+
+	id, req, err := newQuery(name, qtype, ns.protocol == "https")
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := r.exchange(ctx, ns, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips, ttl, truncated, err := parseAnswer(resp, id, name, qtype)
+	if !truncated {
+		return ips, ttl, err
+	}
+	if ns.protocol != "udp" {
+		return nil, 0, errors.New("truncated response")
+	}
+	resp, err = r.exchange(ctx, nameserver{protocol: "tcp", addr: ns.addr}, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips, ttl, _, err = parseAnswer(resp, id, name, qtype)
+	return ips, ttl, err
+}
+
+func (r *Resolver) exchange(ctx context.Context, ns nameserver, req []byte) ([]byte, error) {
+	switch ns.protocol {
+	case "https":
+		return r.exchangeHTTPS(ctx, ns.url, req)
+	case "udp":
+		return r.exchangeUDP(ctx, ns.addr, req)
+	default:
+		return r.exchangeStream(ctx, ns, req)
+	}
+}
+
+func (r *Resolver) exchangeUDP(ctx context.Context, addr string, req []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err = conn.Write(req); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, udpPayloadSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// exchangeStream sends the length prefixed messages over TCP or TLS.
+func (r *Resolver) exchangeStream(ctx context.Context, ns nameserver, req []byte) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	if ns.protocol == "tls" {
+		host, _, _ := net.SplitHostPort(ns.addr)
+		dialer := &tls.Dialer{Config: r.tlsConfig(host)}
+		conn, err = dialer.DialContext(ctx, "tcp", ns.addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", ns.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	msg := make([]byte, 2+len(req))
+	binary.BigEndian.PutUint16(msg, uint16(len(req)))
+	copy(msg[2:], req)
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err = io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exchangeHTTPS sends the DNS message with POST as specified in RFC 8484.
+func (r *Resolver) exchangeHTTPS(ctx context.Context, serverURL string, req []byte) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dnsMessageType)
+	httpReq.Header.Set("Accept", dnsMessageType)
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, math.MaxUint16))
+}
+
+func newQuery(name dnsmessage.Name, qtype dnsmessage.Type, zeroID bool) (uint16, []byte, error) {
+	var id uint16
+	// DoH uses the zero ID for the HTTP cache
+	if !zeroID {
+		var b [2]byte
+		_, _ = rand.Read(b[:])
+		id = binary.BigEndian.Uint16(b[:])
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return 0, nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return 0, nil, err
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return 0, nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(udpPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return 0, nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return 0, nil, err
+	}
+	msg, err := builder.Finish()
+	return id, msg, err
+}
+
+// parseAnswer returns the addresses and the lowest TTL of the answer, the CNAME chain is followed by the server.
+func parseAnswer(resp []byte, id uint16, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, time.Duration, bool, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(resp)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if header.ID != id || !header.Response {
+		return nil, 0, false, errors.New("unexpected response")
+	}
+	if header.Truncated {
+		return nil, 0, true, nil
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, false, errNoSuchHost
+	default:
+		return nil, 0, false, fmt.Errorf("server failure: %s", header.RCode)
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !strings.EqualFold(question.Name.String(), name.String()) || question.Type != qtype {
+		return nil, 0, false, errors.New("unexpected question")
+	}
+	if err = parser.SkipAllQuestions(); err != nil {
+		return nil, 0, false, err
+	}
+	var ips []net.IP
+	ttl := time.Duration(math.MaxInt64)
+	for {
+		h, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if h.Type != qtype || h.Class != dnsmessage.ClassINET {
+			if err = parser.SkipAnswer(); err != nil {
+				return nil, 0, false, err
+			}
+			continue
+		}
+		switch qtype {
+		case dnsmessage.TypeA:
+			a, err := parser.AResource()
+			if err != nil {
+				return nil, 0, false, err
+			}
+			ips = append(ips, net.IP(a.A[:]))
+		case dnsmessage.TypeAAAA:
+			aaaa, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, false, err
+			}
+			ips = append(ips, net.IP(aaaa.AAAA[:]))
+		}
+		if recordTTL := time.Duration(h.TTL) * time.Second; recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, false, errNoSuchHost
+	}
+	return ips, ttl, false, nil
+}
+
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+func (r *Resolver) cached(key string) ([]net.IP, bool) {
+	if r.options.cacheTTL <= 0 {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(r.cache, key)
+		return nil, false
+	}
+	return entry.ips, true
+}
+
+func (r *Resolver) store(key string, ips []net.IP, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if len(r.cache) >= maxCacheEntries {
+		for k, entry := range r.cache {
+			if now.After(entry.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= maxCacheEntries {
+			return
+		}
+	}
+	r.cache[key] = cacheEntry{ips: ips, expires: now.Add(ttl)}
+}
@@ -0,0 +1,302 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeServer answers the A and AAAA queries of the records, the names with the prefix "big." are truncated over UDP.
+// The queries of the failType are answered with a server failure.
+type fakeServer struct {
+	records  map[string][]net.IP
+	failType dnsmessage.Type
+	queries  atomic.Int32
+}
+
+func (s *fakeServer) answer(t *testing.T, req []byte, udp bool) []byte {
+	s.queries.Add(1)
+	var parser dnsmessage.Parser
+	header, err := parser.Start(req)
+	require.NoError(t, err)
+	question, err := parser.Question()
+	require.NoError(t, err)
+
+	name := strings.ToLower(question.Name.String())
+	respHeader := dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true}
+	ips, ok := s.records[name]
+	if !ok {
+		respHeader.RCode = dnsmessage.RCodeNameError
+	}
+	if s.failType != 0 && question.Type == s.failType {
+		respHeader.RCode = dnsmessage.RCodeServerFailure
+		ips = nil
+	}
+	if udp && strings.HasPrefix(name, "big.") {
+		respHeader.Truncated = true
+		ips = nil
+	}
+	builder := dnsmessage.NewBuilder(nil, respHeader)
+	require.NoError(t, builder.StartQuestions())
+	require.NoError(t, builder.Question(question))
+	require.NoError(t, builder.StartAnswers())
+	for _, ip := range ips {
+		rh := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		if ip4 := ip.To4(); ip4 != nil && question.Type == dnsmessage.TypeA {
+			require.NoError(t, builder.AResource(rh, dnsmessage.AResource{A: [4]byte(ip4)}))
+		} else if ip4 == nil && question.Type == dnsmessage.TypeAAAA {
+			require.NoError(t, builder.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}))
+		}
+	}
+	resp, err := builder.Finish()
+	require.NoError(t, err)
+	return resp
+}
+
+func (s *fakeServer) serveUDP(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(s.answer(t, buf[:n], true), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func (s *fakeServer) serveStream(t *testing.T, ln net.Listener) string {
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				resp := s.answer(t, req, false)
+				binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+				_, _ = conn.Write(append(length[:], resp...))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (s *fakeServer) serveHTTPS(t *testing.T) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", dnsMessageType)
+		_, _ = w.Write(s.answer(t, req, false))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolver(t *testing.T) {
+	server := &fakeServer{records: map[string][]net.IP{
+		"app.corp.internal.": {net.ParseIP("2001:db8::1"), net.ParseIP("10.1.2.3")},
+		"big.corp.internal.": {net.ParseIP("10.9.9.9")},
+		"v6.corp.internal.":  {net.ParseIP("2001:db8::2")},
+	}}
+	udpAddr := server.serveUDP(t)
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpAddr := server.serveStream(t, tcpLn)
+	httpsServer := server.serveHTTPS(t)
+	tlsLn := tls.NewListener(mustListen(t), httpsServer.TLS)
+	tlsAddr := server.serveStream(t, tlsLn)
+	tlsConfig := &tls.Config{RootCAs: httpsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, ServerName: "example.com"}
+
+	tests := []struct {
+		name    string
+		servers []string
+		network string
+		host    string
+		want    []string
+		wantErr string
+	}{
+		{name: "udp ipv4 first", servers: []string{udpAddr}, network: "ip", host: "app.corp.internal", want: []string{"10.1.2.3", "2001:db8::1"}},
+		{name: "udp ip4", servers: []string{"udp://" + udpAddr}, network: "ip4", host: "app.corp.internal", want: []string{"10.1.2.3"}},
+		{name: "ip6 only", servers: []string{udpAddr}, network: "ip", host: "v6.corp.internal", want: []string{"2001:db8::2"}},
+		{name: "tcp", servers: []string{"tcp://" + tcpAddr}, network: "ip4", host: "big.corp.internal", want: []string{"10.9.9.9"}},
+		{name: "dot", servers: []string{"tls://" + tlsAddr}, network: "ip4", host: "app.corp.internal", want: []string{"10.1.2.3"}},
+		{name: "doh", servers: []string{httpsServer.URL + "/dns-query"}, network: "ip6", host: "app.corp.internal", want: []string{"2001:db8::1"}},
+		{name: "fallback to next server", servers: []string{"tcp://127.0.0.1:1", udpAddr}, network: "ip4", host: "app.corp.internal", want: []string{"10.1.2.3"}},
+		{name: "no such host", servers: []string{udpAddr, "tcp://127.0.0.1:1"}, network: "ip", host: "missing.corp.internal", wantErr: "no such host"},
+		{name: "ip literal", servers: []string{"tcp://127.0.0.1:1"}, network: "ip", host: "10.0.0.1", want: []string{"10.0.0.1"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewResolver(tc.servers, WithTimeout(time.Second), WithTLSConfig(tlsConfig))
+			require.NoError(t, err)
+			ips, err := r.Resolve(context.Background(), tc.network, tc.host)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestResolverTruncatedRetry(t *testing.T) {
+	server := &fakeServer{records: map[string][]net.IP{"big.corp.internal.": {net.ParseIP("10.9.9.9")}}}
+	// the UDP and TCP servers share the port like a name server
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := server.serveStream(t, tcpLn)
+	udpConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Skipf("udp port %s is not available: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = udpConn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udpConn.WriteTo(server.answer(t, buf[:n], true), from)
+		}
+	}()
+
+	r, err := NewResolver([]string{addr})
+	require.NoError(t, err)
+	ips, err := r.Resolve(context.Background(), "ip4", "big.corp.internal")
+	require.NoError(t, err)
+	require.Equal(t, "10.9.9.9", ips[0].String())
+	require.Equal(t, int32(2), server.queries.Load())
+}
+
+func TestResolverCache(t *testing.T) {
+	server := &fakeServer{records: map[string][]net.IP{"app.corp.internal.": {net.ParseIP("10.1.2.3")}}}
+	addr := server.serveUDP(t)
+
+	r, err := NewResolver([]string{addr}, WithCacheTTL(time.Minute))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		ips, err := r.Resolve(context.Background(), "ip4", "APP.corp.internal")
+		require.NoError(t, err)
+		require.Equal(t, "10.1.2.3", ips[0].String())
+	}
+	require.Equal(t, int32(1), server.queries.Load())
+
+	// the record TTL is lower than the cache TTL
+	r.mu.Lock()
+	entry := r.cache["ip4/app.corp.internal"]
+	r.mu.Unlock()
+	require.WithinDuration(t, time.Now().Add(60*time.Second), entry.expires, 5*time.Second)
+
+	uncached, err := NewResolver([]string{addr}, WithCacheTTL(0))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = uncached.Resolve(context.Background(), "ip4", "app.corp.internal")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(3), server.queries.Load())
+}
+
+func TestResolverPartialFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		failType dnsmessage.Type
+		want     string
+	}{
+		{name: "AAAA failure", failType: dnsmessage.TypeAAAA, want: "10.1.2.3"},
+		{name: "A failure", failType: dnsmessage.TypeA, want: "fd00::1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &fakeServer{
+				records:  map[string][]net.IP{"app.corp.internal.": {net.ParseIP("10.1.2.3"), net.ParseIP("fd00::1")}},
+				failType: tc.failType,
+			}
+			addr := server.serveUDP(t)
+
+			r, err := NewResolver([]string{addr}, WithCacheTTL(time.Minute))
+			require.NoError(t, err)
+			ips, err := r.Resolve(context.Background(), "ip", "app.corp.internal")
+			require.NoError(t, err)
+			require.Len(t, ips, 1)
+			require.Equal(t, tc.want, ips[0].String())
+
+			// the partial answer is not cached
+			_, err = r.Resolve(context.Background(), "ip", "app.corp.internal")
+			require.NoError(t, err)
+			require.Equal(t, int32(4), server.queries.Load())
+
+			// the failure is returned without addresses
+			_, err = r.Resolve(context.Background(), "ip", "missing.corp.internal")
+			require.ErrorContains(t, err, "server failure")
+		})
+	}
+}
+
+func TestParseNameserver(t *testing.T) {
+	tests := []struct {
+		server  string
+		want    string
+		wantErr string
+	}{
+		{server: "10.0.0.2", want: "udp://10.0.0.2:53"},
+		{server: "tcp://10.0.0.2", want: "tcp://10.0.0.2:53"},
+		{server: "tls://1.1.1.1", want: "tls://1.1.1.1:853"},
+		{server: "[2001:db8::53]:5353", want: "udp://[2001:db8::53]:5353"},
+		{server: "https://1.1.1.1/dns-query", want: "https://1.1.1.1/dns-query"},
+		{server: "quic://1.1.1.1", wantErr: `unsupported protocol "quic"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.server, func(t *testing.T) {
+			ns, err := parseNameserver(tc.server)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, ns.String())
+		})
+	}
+}
+
+func mustListen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return ln
+}
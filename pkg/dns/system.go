@@ -0,0 +1,28 @@
+package dns
+
+import (
+	"context"
+	"net"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+)
+
+// SystemResolver resolves the hosts with the resolver of the operating system.
+type SystemResolver struct{}
+
+var _ gost.Resolver = SystemResolver{}
+
+func (SystemResolver) Resolve(ctx context.Context, network, host string, _ ...gost.ResolverOption) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	switch network {
+	case "ip4", "tcp4", "udp4":
+		network = "ip4"
+	case "ip6", "tcp6", "udp6":
+		network = "ip6"
+	default:
+		network = "ip"
+	}
+	return net.DefaultResolver.LookupIP(ctx, network, host)
+}
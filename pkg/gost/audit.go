@@ -0,0 +1,37 @@
+package gost
+
+import (
+	"time"
+)
+
+const (
+	AuditAllowed       = "allowed"
+	AuditAuthFailed    = "auth-failed"
+	AuditBypassBlocked = "bypass-blocked"
+	AuditAuthzDenied   = "authz-denied"
+	AuditLimited       = "limited"
+	AuditDialFailed    = "dial-failed"
+	AuditBadRequest    = "bad-request"
+)
+
+// AuditRecord describes a single tunnel request and its outcome.
+type AuditRecord struct {
+	Time        time.Time     `json:"time"`
+	User        string        `json:"user,omitempty"`
+	Subject     string        `json:"subject,omitempty"`
+	Groups      []string      `json:"groups,omitempty"`
+	AgentID     string        `json:"agent_id,omitempty"`
+	SourceIP    string        `json:"source_ip,omitempty"`
+	Network     string        `json:"network"`
+	Destination string        `json:"destination"`
+	Decision    string        `json:"decision"`
+	Reason      string        `json:"reason,omitempty"`
+	BytesUp     int64         `json:"bytes_up"`
+	BytesDown   int64         `json:"bytes_down"`
+	Duration    time.Duration `json:"duration_ns"`
+}
+
+// Auditor receives a record for every handled tunnel request.
+type Auditor interface {
+	Audit(record *AuditRecord)
+}
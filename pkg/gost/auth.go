@@ -9,3 +9,13 @@ type AuthOption func(opts *authOptions)
 type Authenticator interface {
 	Authenticate(ctx context.Context, user, password string, opts ...AuthOption) (id string, ok bool)
 }
+
+type ClientIdentity struct {
+	Subject string
+	Groups  []string
+}
+
+// IdentityAuthenticator is an Authenticator which additionally resolves the identity of the client.
+type IdentityAuthenticator interface {
+	AuthenticateIdentity(ctx context.Context, user, password string, opts ...AuthOption) (id string, identity *ClientIdentity, ok bool)
+}
@@ -0,0 +1,31 @@
+package gost
+
+import "context"
+
+type authorizeOptions struct{}
+
+type AuthorizeOption func(opts *authorizeOptions)
+
+// Authorizer decides if the authenticated client is allowed to reach the destination, nil error allows the request.
+type Authorizer interface {
+	Authorize(ctx context.Context, network, addr string, opts ...AuthorizeOption) error
+}
+
+type chainAuthorizer []Authorizer
+
+// ChainAuthorizers allows the request only if all authorizers allow it.
+func ChainAuthorizers(authorizers ...Authorizer) Authorizer {
+	if len(authorizers) == 1 {
+		return authorizers[0]
+	}
+	return chainAuthorizer(authorizers)
+}
+
+func (c chainAuthorizer) Authorize(ctx context.Context, network, addr string, opts ...AuthorizeOption) error {
+	for _, authorizer := range c {
+		if err := authorizer.Authorize(ctx, network, addr, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -23,6 +23,19 @@ type ConnectorAuth interface {
 	Auth(ctx context.Context) *url.Userinfo
 }
 
+type staticConnectorAuth struct {
+	user *url.Userinfo
+}
+
+// NewStaticConnectorAuth returns the connector credentials configured for the upstream proxy.
+func NewStaticConnectorAuth(user *url.Userinfo) ConnectorAuth {
+	return &staticConnectorAuth{user: user}
+}
+
+func (a *staticConnectorAuth) Auth(context.Context) *url.Userinfo {
+	return a.user
+}
+
 type connectorOptions struct {
 	auth           ConnectorAuth
 	tlsConfig      *tls.Config
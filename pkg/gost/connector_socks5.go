@@ -0,0 +1,77 @@
+package gost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"golang.org/x/net/proxy"
+)
+
+// socks5ConnDialer is the SOCKS5 client of x/net/proxy connecting over an established connection.
+type socks5ConnDialer interface {
+	DialWithConn(ctx context.Context, c net.Conn, network, address string) (net.Addr, error)
+}
+
+type socks5Connector struct {
+	options connectorOptions
+}
+
+func NewSocks5Connector(opts ...ConnectorOption) Connector {
+	options := connectorOptions{
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "socks5-connector"}),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &socks5Connector{
+		options: options,
+	}
+}
+
+func (c *socks5Connector) Connect(ctx context.Context, conn net.Conn, network, address string, opts ...ConnectOption) (net.Conn, error) {
+	log := c.options.logger.WithFields(map[string]any{
+		"local":   conn.LocalAddr().String(),
+		"remote":  conn.RemoteAddr().String(),
+		"network": network,
+		"address": address,
+	})
+	log.Debugf("connect %s/%s", address, network)
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		err := fmt.Errorf("network %s is unsupported", network)
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	var auth *proxy.Auth
+	if c.options.auth != nil {
+		if user := c.options.auth.Auth(ctx); user != nil {
+			password, _ := user.Password()
+			auth = &proxy.Auth{User: user.Username(), Password: password}
+		}
+	}
+	d, err := proxy.SOCKS5("tcp", conn.RemoteAddr().String(), auth, nil)
+	if err != nil {
+		return nil, err
+	}
+	connDialer, ok := d.(socks5ConnDialer)
+	if !ok {
+		return nil, errors.New("socks5 dialer does not support established connections")
+	}
+	if c.options.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.connectTimeout)
+		defer cancel()
+	}
+	// the connection deadline is set from the context during the handshake
+	if _, err = connDialer.DialWithConn(ctx, conn, network, address); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
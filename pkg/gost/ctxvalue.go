@@ -2,6 +2,8 @@ package gost
 
 import (
 	"context"
+	"crypto/x509"
+	"net"
 	"net/url"
 )
 
@@ -35,3 +37,49 @@ func ProxyAuthorizationFromContext(ctx context.Context) *url.Userinfo {
 	v, _ := ctx.Value(keyProxyAuthorization).(*url.Userinfo)
 	return v
 }
+
+type clientIdentityKey struct{}
+
+var (
+	keyClientIdentity = &clientIdentityKey{}
+)
+
+func ContextWithClientIdentity(ctx context.Context, identity *ClientIdentity) context.Context {
+	return context.WithValue(ctx, keyClientIdentity, identity)
+}
+
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	v, _ := ctx.Value(keyClientIdentity).(*ClientIdentity)
+	return v
+}
+
+type peerCertificateKey struct{}
+
+var (
+	keyPeerCertificate = &peerCertificateKey{}
+)
+
+// ContextWithPeerCertificate stores the verified client certificate of the TLS connection.
+func ContextWithPeerCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, keyPeerCertificate, cert)
+}
+
+func PeerCertificateFromContext(ctx context.Context) *x509.Certificate {
+	v, _ := ctx.Value(keyPeerCertificate).(*x509.Certificate)
+	return v
+}
+
+type srcAddrKey struct{}
+
+var (
+	keySrcAddr = &srcAddrKey{}
+)
+
+func ContextWithSrcAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, keySrcAddr, addr)
+}
+
+func SrcAddrFromContext(ctx context.Context) net.Addr {
+	v, _ := ctx.Value(keySrcAddr).(net.Addr)
+	return v
+}
@@ -5,13 +5,16 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,12 +33,16 @@ type Handler interface {
 type handlerOptions struct {
 	logger *logger.Logger
 
-	bypass    Bypass
-	router    *Router
-	auth      *url.Userinfo
-	auther    Authenticator
-	tlsConfig *tls.Config
-	proxyOnly bool
+	bypass     Bypass
+	router     *Router
+	auth       *url.Userinfo
+	auther     Authenticator
+	authorizer Authorizer
+	auditor    Auditor
+	limits     TransportLimits
+	limiter    Limiter
+	tlsConfig  *tls.Config
+	proxyOnly  bool
 }
 
 type HandlerOption func(opts *handlerOptions)
@@ -71,6 +78,7 @@ func (h *httpHandler) Handle(ctx context.Context, conn net.Conn, opts ...HandleO
 		"local":  conn.LocalAddr().String(),
 	})
 	log.Infof("handle http %s -> %s", conn.RemoteAddr(), conn.LocalAddr())
+	ctx = ContextWithSrcAddr(ctx, conn.RemoteAddr())
 	defer func() {
 		log.With(slog.Duration("duration", time.Since(start))).
 			Infof("handle http %s <- %s", conn.RemoteAddr(), conn.LocalAddr())
@@ -114,8 +122,17 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 	fields := map[string]any{
 		"dst": addr,
 	}
+	record := &AuditRecord{
+		Time:        time.Now(),
+		Network:     network,
+		Destination: addr,
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		record.SourceIP = host
+	}
 	if u, p, _ := h.basicProxyAuth(req.Header.Get("Proxy-Authorization"), log); u != "" {
 		fields["user"] = u
+		record.User = u
 		ctx = ContextWithProxyAuthorization(ctx, url.UserPassword(u, p))
 	}
 	log = log.WithFields(fields)
@@ -132,11 +149,20 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 		Header:     http.Header{},
 	}
 
-	clientID, ok := h.authenticate(ctx, conn, req, resp, log)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if state := tlsConn.ConnectionState(); len(state.VerifiedChains) != 0 && len(state.VerifiedChains[0]) != 0 {
+			ctx = ContextWithPeerCertificate(ctx, state.VerifiedChains[0][0])
+		}
+	}
+	clientID, identity, ok := h.authenticate(ctx, conn, req, resp, log)
 	if !ok {
+		h.audit(ctx, record, AuditAuthFailed, nil)
 		return nil
 	}
 	ctx = ContextWithClientID(ctx, ClientID(clientID))
+	if identity != nil {
+		ctx = ContextWithClientIdentity(ctx, identity)
+	}
 
 	if h.options.bypass != nil && h.options.bypass.Contains(ctx, network, addr) {
 		resp.StatusCode = http.StatusForbidden
@@ -146,10 +172,26 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 			log.Trace(string(dump))
 		}
 		log.Debugf("bypass: %s", addr)
+		h.audit(ctx, record, AuditBypassBlocked, nil)
 
 		return resp.Write(conn)
 	}
 
+	if h.options.authorizer != nil {
+		if err := h.options.authorizer.Authorize(ctx, network, addr); err != nil {
+			resp.StatusCode = http.StatusForbidden
+
+			if log.IsLevelEnabled(logger.LevelTrace) {
+				dump, _ := httputil.DumpResponse(resp, false)
+				log.Trace(string(dump))
+			}
+			log.Infof("authorization denied: %s", err)
+			h.audit(ctx, record, AuditAuthzDenied, err)
+
+			return resp.Write(conn)
+		}
+	}
+
 	if req.Method == "PRI" ||
 		(req.Method != http.MethodConnect && req.URL.Scheme != "http") {
 		resp.StatusCode = http.StatusBadRequest
@@ -158,13 +200,48 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 			dump, _ := httputil.DumpResponse(resp, false)
 			log.Trace(string(dump))
 		}
+		h.audit(ctx, record, AuditBadRequest, fmt.Errorf("unsupported request %s %s", req.Method, req.URL))
 
 		return resp.Write(conn)
 	}
 
+	var reservation Reservation
+	if h.options.limiter != nil {
+		var err error
+		if reservation, err = h.options.limiter.Reserve(ctx, network, addr); err != nil {
+			resp.StatusCode = http.StatusTooManyRequests
+			var limitErr *LimitExceededError
+			if errors.As(err, &limitErr) && limitErr.RetryAfter > 0 {
+				resp.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+			}
+
+			if log.IsLevelEnabled(logger.LevelTrace) {
+				dump, _ := httputil.DumpResponse(resp, false)
+				log.Trace(string(dump))
+			}
+			log.Infof("tunnel rejected: %s", err)
+			h.audit(ctx, record, AuditLimited, err)
+
+			return resp.Write(conn)
+		}
+		defer reservation.Release()
+	}
+
 	req.Header.Del("Proxy-Authorization")
 
 	cc, err := h.router.Dial(ctx, network, addr)
+	if errors.Is(err, ErrDestinationDenied) {
+		resp.StatusCode = http.StatusForbidden
+
+		if log.IsLevelEnabled(logger.LevelTrace) {
+			dump, _ := httputil.DumpResponse(resp, false)
+			log.Trace(string(dump))
+		}
+		log.Infof("destination denied: %s", err)
+		h.audit(ctx, record, AuditBypassBlocked, err)
+
+		return resp.Write(conn)
+	}
 	if err != nil {
 		resp.StatusCode = http.StatusServiceUnavailable
 
@@ -173,9 +250,13 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 			log.Trace(string(dump))
 		}
 		_ = resp.Write(conn)
+		h.audit(ctx, record, AuditDialFailed, err)
 		return err
 	}
 	defer cc.Close()
+	if reservation != nil {
+		cc = reservation.Wrap(cc)
+	}
 
 	if req.Method == http.MethodConnect {
 		resp.StatusCode = http.StatusOK
@@ -187,26 +268,55 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 		}
 		if err = resp.Write(conn); err != nil {
 			log.Error(err.Error())
+			h.audit(ctx, record, AuditAllowed, err)
 			return err
 		}
 	} else {
 		req.Header.Del("Proxy-Connection")
 		if err = req.Write(cc); err != nil {
 			log.Error(err.Error())
+			h.audit(ctx, record, AuditAllowed, err)
 			return err
 		}
 	}
 
 	start := time.Now()
 	log.Infof("%s -> %s", conn.RemoteAddr(), addr)
-	_ = NetTransport(conn, cc)
-	log.WithFields(map[string]any{
-		"duration": time.Since(start),
-	}).Infof("%s <- %s", conn.RemoteAddr(), addr)
+	stats := NetTransport(conn, cc, WithNetTransportLimits(h.options.limits))
+	fields = map[string]any{
+		"duration":   time.Since(start),
+		"bytes_up":   stats.BytesFirstToSecond,
+		"bytes_down": stats.BytesSecondToFirst,
+	}
+	if stats.CloseReason != "" {
+		fields["close_reason"] = stats.CloseReason
+	}
+	log.WithFields(fields).Infof("%s <- %s", conn.RemoteAddr(), addr)
+	record.Reason = stats.CloseReason
+	record.BytesUp = stats.BytesFirstToSecond
+	record.BytesDown = stats.BytesSecondToFirst
+	h.audit(ctx, record, AuditAllowed, stats.Err())
 
 	return nil
 }
 
+func (h *httpHandler) audit(ctx context.Context, record *AuditRecord, decision string, reason error) {
+	if h.options.auditor == nil {
+		return
+	}
+	record.Decision = decision
+	if reason != nil {
+		record.Reason = reason.Error()
+	}
+	record.AgentID = string(ClientIDFromContext(ctx))
+	if identity := ClientIdentityFromContext(ctx); identity != nil {
+		record.Subject = identity.Subject
+		record.Groups = identity.Groups
+	}
+	record.Duration = time.Since(record.Time)
+	h.options.auditor.Audit(record)
+}
+
 func (h *httpHandler) basicProxyAuth(proxyAuth string, _ *logger.Logger) (username, password string, ok bool) {
 	if proxyAuth == "" {
 		return
@@ -228,12 +338,16 @@ func (h *httpHandler) basicProxyAuth(proxyAuth string, _ *logger.Logger) (userna
 	return cs[:s], cs[s+1:], true
 }
 
-func (h *httpHandler) authenticate(ctx context.Context, conn net.Conn, req *http.Request, resp *http.Response, log *logger.Logger) (id string, ok bool) {
+func (h *httpHandler) authenticate(ctx context.Context, conn net.Conn, req *http.Request, resp *http.Response, log *logger.Logger) (id string, identity *ClientIdentity, ok bool) {
 	u, p, _ := h.basicProxyAuth(req.Header.Get("Proxy-Authorization"), log)
 	if h.options.auther == nil {
-		return "", true
+		return "", nil, true
 	}
-	if id, ok = h.options.auther.Authenticate(ctx, u, p); ok {
+	if identityAuther, isIdentityAuther := h.options.auther.(IdentityAuthenticator); isIdentityAuther {
+		if id, identity, ok = identityAuther.AuthenticateIdentity(ctx, u, p); ok {
+			return
+		}
+	} else if id, ok = h.options.auther.Authenticate(ctx, u, p); ok {
 		return
 	}
 	if resp.Header == nil {
@@ -287,6 +401,31 @@ func WithHandlerAuther(auther Authenticator) HandlerOption {
 	}
 }
 
+func WithHandlerAuthorizer(authorizer Authorizer) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.authorizer = authorizer
+	}
+}
+
+func WithHandlerAuditor(auditor Auditor) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.auditor = auditor
+	}
+}
+
+// WithHandlerTransportLimits sets the idle timeout, max duration and max bytes of the tunnels.
+func WithHandlerTransportLimits(limits TransportLimits) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.limits = limits
+	}
+}
+
+func WithHandlerLimiter(limiter Limiter) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.limiter = limiter
+	}
+}
+
 func WithHandlerTLSConfig(tlsConfig *tls.Config) HandlerOption {
 	return func(opts *handlerOptions) {
 		opts.tlsConfig = tlsConfig
@@ -0,0 +1,98 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAuditor struct {
+	records chan *AuditRecord
+}
+
+func (a *recordingAuditor) Audit(record *AuditRecord) {
+	a.records <- record
+}
+
+// rejectingLimiter counts the reservations and rejects them.
+type rejectingLimiter struct {
+	reserved atomic.Int32
+}
+
+func (l *rejectingLimiter) Reserve(context.Context, string, string) (Reservation, error) {
+	l.reserved.Add(1)
+	return nil, &LimitExceededError{Reason: "test"}
+}
+
+func TestHandlerAuditBadRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+	}{
+		{name: "http2 preface", request: "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"},
+		{name: "unsupported scheme", request: "GET ftp://example.com/file HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			auditor := &recordingAuditor{records: make(chan *AuditRecord, 1)}
+			limiter := &rejectingLimiter{}
+			handler := NewHttpHandler(WithHandlerAuditor(auditor), WithHandlerLimiter(limiter))
+
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				_ = handler.Handle(context.Background(), server)
+			}()
+
+			go func() {
+				_, _ = io.WriteString(client, tc.request)
+			}()
+			resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+			record := <-auditor.records
+			require.Equal(t, AuditBadRequest, record.Decision)
+			require.NotEmpty(t, record.Reason)
+			// the rejected request does not use the limits of the client
+			require.Zero(t, limiter.reserved.Load())
+		})
+	}
+}
+
+func TestHandlerAuditResponseWriteFailure(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	auditor := &recordingAuditor{records: make(chan *AuditRecord, 1)}
+	handler := NewHttpHandler(WithHandlerAuditor(auditor))
+
+	client, server := net.Pipe()
+	go func() {
+		_ = handler.Handle(context.Background(), server)
+	}()
+	// the client closes the connection before the response is written
+	_, err = io.WriteString(client, "CONNECT "+target.Addr().String()+" HTTP/1.1\r\nHost: "+target.Addr().String()+"\r\n\r\n")
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	record := <-auditor.records
+	require.Equal(t, AuditAllowed, record.Decision)
+	require.NotEmpty(t, record.Reason)
+}
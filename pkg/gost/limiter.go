@@ -0,0 +1,31 @@
+package gost
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Limiter admits new tunnels of the authenticated clients.
+type Limiter interface {
+	// Reserve returns the reservation for the new tunnel or LimitExceededError.
+	Reserve(ctx context.Context, network, addr string) (Reservation, error)
+}
+
+type Reservation interface {
+	// Wrap applies the bandwidth limits to the target connection of the tunnel.
+	Wrap(conn net.Conn) net.Conn
+	// Release must be called when the tunnel is closed.
+	Release()
+}
+
+// LimitExceededError rejects the tunnel, the client can retry after the duration.
+type LimitExceededError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limit exceeded: %s", e.Reason)
+}
@@ -1,36 +1,300 @@
 package gost
 
 import (
+	"errors"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	bufferSize = 64 * 1024
+	// maxWatchdogInterval is the maximal interval of the tunnel limits checks.
+	maxWatchdogInterval = time.Second
 )
 
-func NetTransport(rw1, rw2 io.ReadWriter) error {
-	errc := make(chan error, 1)
+const (
+	// FirstSide is the first read writer passed to NetTransport.
+	FirstSide = 1
+	// SecondSide is the second read writer passed to NetTransport.
+	SecondSide = 2
+)
+
+const (
+	CloseReasonIdleTimeout = "idle timeout"
+	CloseReasonMaxDuration = "max duration"
+	CloseReasonMaxBytes    = "max bytes"
+)
+
+// TransportLimits close the transport, zero values disable the limits.
+type TransportLimits struct {
+	// IdleTimeout is the maximal time without data in any direction.
+	IdleTimeout time.Duration
+	// MaxDuration is the maximal lifetime of the transport.
+	MaxDuration time.Duration
+	// MaxBytes is the maximal number of bytes transferred in both directions.
+	MaxBytes int64
+}
+
+func (l TransportLimits) enabled() bool {
+	return l.IdleTimeout > 0 || l.MaxDuration > 0 || l.MaxBytes > 0
+}
+
+type netTransportOptions struct {
+	limits TransportLimits
+}
+
+type NetTransportOption func(opts *netTransportOptions)
+
+func WithNetTransportLimits(limits TransportLimits) NetTransportOption {
+	return func(opts *netTransportOptions) {
+		opts.limits = limits
+	}
+}
+
+// TransportStats describes the finished transport between two read writers.
+type TransportStats struct {
+	// BytesFirstToSecond is the number of bytes read from the first and written to the second read writer.
+	BytesFirstToSecond int64
+	// BytesSecondToFirst is the number of bytes read from the second and written to the first read writer.
+	BytesSecondToFirst int64
+	// ErrFirstToSecond is the copy error of the first to second direction, EOF is not an error.
+	ErrFirstToSecond error
+	// ErrSecondToFirst is the copy error of the second to first direction, EOF is not an error.
+	ErrSecondToFirst error
+	// FirstCloser is the side, which stopped sending first.
+	FirstCloser int
+	// CloseReason is the exceeded limit, which closed the transport.
+	CloseReason string
+	Duration    time.Duration
+}
+
+// Err returns the error of the direction, which finished first.
+func (s *TransportStats) Err() error {
+	if s.FirstCloser == SecondSide {
+		return s.ErrSecondToFirst
+	}
+	return s.ErrFirstToSecond
+}
+
+type copyResult struct {
+	from       int
+	n          int64
+	err        error
+	halfClosed bool
+}
+
+// NetTransport copies the data in both directions. When one side stops sending (EOF), the write side of the other
+// is closed and the opposite direction is drained independently. If the half-close is not supported or the copy
+// fails, the reads of the other direction are stopped by the read deadline, a read writer without read deadline
+// support is not awaited. Exceeded limits stop both directions.
+func NetTransport(rw1, rw2 io.ReadWriter, opts ...NetTransportOption) *TransportStats {
+	var options netTransportOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	start := time.Now()
+
+	var w *watchdog
+	if options.limits.enabled() {
+		w = newWatchdog(options.limits, start, rw1, rw2)
+		defer w.stop()
+	}
+	results := make(chan copyResult, 2)
 	go func() {
-		errc <- copyBuffer(rw1, rw2)
+		results <- copyHalf(FirstSide, rw2, rw1, w)
 	}()
-
 	go func() {
-		errc <- copyBuffer(rw2, rw1)
+		results <- copyHalf(SecondSide, rw1, rw2, w)
 	}()
 
-	if err := <-errc; err != nil && err != io.EOF {
-		return err
+	stats := &TransportStats{}
+	first := <-results
+	stats.FirstCloser = first.from
+	stats.set(first)
+
+	other := rw1
+	if first.from == FirstSide {
+		other = rw2
+	}
+	if first.halfClosed {
+		stats.set(<-results)
+	} else if setReadDeadline(other, time.Now()) {
+		second := <-results
+		if errors.Is(second.err, os.ErrDeadlineExceeded) {
+			second.err = nil
+		}
+		stats.set(second)
+	}
+	if w != nil {
+		if stats.CloseReason = w.closeReason(); stats.CloseReason != "" {
+			// the deadline errors are caused by the exceeded limit
+			if errors.Is(stats.ErrFirstToSecond, os.ErrDeadlineExceeded) {
+				stats.ErrFirstToSecond = nil
+			}
+			if errors.Is(stats.ErrSecondToFirst, os.ErrDeadlineExceeded) {
+				stats.ErrSecondToFirst = nil
+			}
+		}
+	}
+	stats.Duration = time.Since(start)
+	return stats
+}
+
+func (s *TransportStats) set(result copyResult) {
+	err := result.err
+	if err == io.EOF {
+		err = nil
+	}
+	if result.from == FirstSide {
+		s.BytesFirstToSecond = result.n
+		s.ErrFirstToSecond = err
+	} else {
+		s.BytesSecondToFirst = result.n
+		s.ErrSecondToFirst = err
+	}
+}
+
+func copyHalf(from int, dst io.Writer, src io.Reader, w *watchdog) copyResult {
+	var writer io.Writer = dst
+	if w != nil {
+		writer = &meteredWriter{Writer: dst, watchdog: w}
 	}
+	n, err := copyBuffer(writer, src)
+	result := copyResult{from: from, n: n, err: err}
+	if err == nil {
+		result.halfClosed = closeWrite(dst)
+	}
+	return result
+}
+
+// closeWrite signals EOF to the peer while the reading continues e.g. TCP FIN or QUIC stream FIN.
+func closeWrite(w io.Writer) bool {
+	conn, ok := w.(interface{ CloseWrite() error })
+	if !ok {
+		return false
+	}
+	return conn.CloseWrite() == nil
+}
+
+func setReadDeadline(rw io.ReadWriter, t time.Time) bool {
+	conn, ok := rw.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return false
+	}
+	return conn.SetReadDeadline(t) == nil
+}
+
+// abort stops the pending reads and writes by the deadline or closes the read writer.
+func abort(rw io.ReadWriter) {
+	if conn, ok := rw.(interface{ SetDeadline(time.Time) error }); ok && conn.SetDeadline(time.Now()) == nil {
+		return
+	}
+	if closer, ok := rw.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// watchdog enforces the transport limits.
+type watchdog struct {
+	limits     TransportLimits
+	start      time.Time
+	rws        []io.ReadWriter
+	bytes      atomic.Int64
+	lastActive atomic.Int64
+	reason     atomic.Pointer[string]
+	once       sync.Once
+	done       chan struct{}
+}
+
+func newWatchdog(limits TransportLimits, start time.Time, rws ...io.ReadWriter) *watchdog {
+	w := &watchdog{
+		limits: limits,
+		start:  start,
+		rws:    rws,
+		done:   make(chan struct{}),
+	}
+	w.lastActive.Store(start.UnixNano())
+	if limits.IdleTimeout > 0 || limits.MaxDuration > 0 {
+		go w.run()
+	}
+	return w
+}
+
+func (w *watchdog) interval() time.Duration {
+	interval := maxWatchdogInterval
+	for _, limit := range []time.Duration{w.limits.IdleTimeout, w.limits.MaxDuration} {
+		if limit > 0 && limit/4 < interval {
+			interval = limit / 4
+		}
+	}
+	return max(interval, time.Millisecond)
+}
+
+func (w *watchdog) run() {
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			if w.limits.MaxDuration > 0 && now.Sub(w.start) >= w.limits.MaxDuration {
+				w.trigger(CloseReasonMaxDuration)
+				return
+			}
+			if w.limits.IdleTimeout > 0 && now.Sub(time.Unix(0, w.lastActive.Load())) >= w.limits.IdleTimeout {
+				w.trigger(CloseReasonIdleTimeout)
+				return
+			}
+		}
+	}
+}
+
+func (w *watchdog) add(n int) {
+	w.lastActive.Store(time.Now().UnixNano())
+	if bytes := w.bytes.Add(int64(n)); w.limits.MaxBytes > 0 && bytes >= w.limits.MaxBytes {
+		w.trigger(CloseReasonMaxBytes)
+	}
+}
+
+func (w *watchdog) trigger(reason string) {
+	w.once.Do(func() {
+		w.reason.Store(&reason)
+		for _, rw := range w.rws {
+			abort(rw)
+		}
+	})
+}
+
+func (w *watchdog) closeReason() string {
+	if reason := w.reason.Load(); reason != nil {
+		return *reason
+	}
+	return ""
+}
+
+func (w *watchdog) stop() {
+	close(w.done)
+}
+
+type meteredWriter struct {
+	io.Writer
+	watchdog *watchdog
+}
 
-	return nil
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.Writer.Write(p)
+	m.watchdog.add(n)
+	return n, err
 }
 
-func copyBuffer(dst io.Writer, src io.Reader) error {
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
 	buf := bufPool.Get().(*[]byte)
 	defer bufPool.Put(buf)
-	_, err := io.CopyBuffer(dst, src, *buf)
-	return err
+	return io.CopyBuffer(dst, src, *buf)
 }
 
 var bufPool = sync.Pool{
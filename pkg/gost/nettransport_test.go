@@ -0,0 +1,152 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetTransportStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		firstCloser int
+	}{
+		{name: "client closes first", firstCloser: FirstSide},
+		{name: "target closes first", firstCloser: SecondSide},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, clientPeer := net.Pipe()
+			target, targetPeer := net.Pipe()
+			defer clientPeer.Close()
+			defer targetPeer.Close()
+
+			done := make(chan *TransportStats)
+			go func() {
+				done <- NetTransport(clientPeer, targetPeer)
+			}()
+
+			_, err := client.Write([]byte("request"))
+			require.NoError(t, err)
+			buf := make([]byte, 7)
+			_, err = io.ReadFull(target, buf)
+			require.NoError(t, err)
+			require.Equal(t, "request", string(buf))
+
+			_, err = target.Write([]byte("response-body"))
+			require.NoError(t, err)
+			buf = make([]byte, 13)
+			_, err = io.ReadFull(client, buf)
+			require.NoError(t, err)
+
+			if tc.firstCloser == FirstSide {
+				require.NoError(t, client.Close())
+			} else {
+				require.NoError(t, target.Close())
+			}
+			stats := <-done
+			require.Equal(t, tc.firstCloser, stats.FirstCloser)
+			require.Equal(t, int64(7), stats.BytesFirstToSecond)
+			require.Equal(t, int64(13), stats.BytesSecondToFirst)
+			require.NoError(t, stats.ErrFirstToSecond)
+			require.NoError(t, stats.ErrSecondToFirst)
+			require.NoError(t, stats.Err())
+		})
+	}
+}
+
+func TestNetTransportHalfClose(t *testing.T) {
+	client, clientPeer := tcpPair(t)
+	target, targetPeer := tcpPair(t)
+	defer client.Close()
+	defer target.Close()
+
+	done := make(chan *TransportStats)
+	go func() {
+		stats := NetTransport(clientPeer, targetPeer)
+		_ = clientPeer.Close()
+		_ = targetPeer.Close()
+		done <- stats
+	}()
+
+	// the client sends the request and signals EOF, the target replies after reading the whole request
+	_, err := client.Write([]byte("request"))
+	require.NoError(t, err)
+	require.NoError(t, client.CloseWrite())
+
+	request, err := io.ReadAll(target)
+	require.NoError(t, err)
+	require.Equal(t, "request", string(request))
+	_, err = target.Write([]byte("response-body"))
+	require.NoError(t, err)
+	require.NoError(t, target.Close())
+
+	response, err := io.ReadAll(client)
+	require.NoError(t, err)
+	require.Equal(t, "response-body", string(response))
+
+	stats := <-done
+	require.Equal(t, FirstSide, stats.FirstCloser)
+	require.Equal(t, int64(7), stats.BytesFirstToSecond)
+	require.Equal(t, int64(13), stats.BytesSecondToFirst)
+	require.NoError(t, stats.ErrFirstToSecond)
+	require.NoError(t, stats.ErrSecondToFirst)
+}
+
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	peer := <-accepted
+	require.NotNil(t, peer)
+	return conn.(*net.TCPConn), peer.(*net.TCPConn)
+}
+
+func TestNetTransportLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits TransportLimits
+		reason string
+	}{
+		{name: "idle timeout", limits: TransportLimits{IdleTimeout: 50 * time.Millisecond}, reason: CloseReasonIdleTimeout},
+		{name: "max duration", limits: TransportLimits{MaxDuration: 50 * time.Millisecond, IdleTimeout: time.Hour}, reason: CloseReasonMaxDuration},
+		{name: "max bytes", limits: TransportLimits{MaxBytes: 5}, reason: CloseReasonMaxBytes},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, clientPeer := tcpPair(t)
+			target, targetPeer := tcpPair(t)
+			defer client.Close()
+			defer target.Close()
+			defer clientPeer.Close()
+			defer targetPeer.Close()
+
+			done := make(chan *TransportStats)
+			go func() {
+				done <- NetTransport(clientPeer, targetPeer, WithNetTransportLimits(tc.limits))
+			}()
+			_, err := client.Write([]byte("request"))
+			require.NoError(t, err)
+
+			select {
+			case stats := <-done:
+				require.Equal(t, tc.reason, stats.CloseReason)
+				require.NoError(t, stats.ErrFirstToSecond)
+				require.NoError(t, stats.ErrSecondToFirst)
+			case <-time.After(5 * time.Second):
+				t.Fatal("transport was not closed")
+			}
+		})
+	}
+}
@@ -5,17 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/grepplabs/reverse-http/pkg/logger"
 )
 
 var (
 	ErrInvalidResolver = errors.New("invalid resolver")
+	// ErrDestinationDenied is returned by the resolvers checking the resolved addresses, the request is forbidden.
+	ErrDestinationDenied = errors.New("destination denied")
 )
 
-type resolverOptions struct{}
+type ResolverOptions struct {
+	// Port is the destination port, -1 when unknown.
+	Port int
+}
+
+type ResolverOption func(opts *ResolverOptions)
 
-type ResolverOption func(opts *resolverOptions)
+func WithResolverPort(port int) ResolverOption {
+	return func(opts *ResolverOptions) {
+		opts.Port = port
+	}
+}
 
 type Resolver interface {
 	Resolve(ctx context.Context, network, host string, opts ...ResolverOption) ([]net.IP, error)
@@ -39,11 +51,18 @@ func Resolve(ctx context.Context, network, addr string, r Resolver, hosts HostMa
 	}
 
 	if r != nil {
-		ips, err := r.Resolve(ctx, network, host)
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			portNum = -1
+		}
+		ips, err := r.Resolve(ctx, network, host, WithResolverPort(portNum))
 		if err != nil {
 			if errors.Is(err, ErrInvalidResolver) {
 				return addr, nil
 			}
+			if errors.Is(err, ErrDestinationDenied) {
+				return "", err
+			}
 			log.Error(err.Error())
 		}
 		if len(ips) == 0 {
@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -26,18 +27,39 @@ func GeneratePublicKey(conf *config.AuthKeyPublicCmd) error {
 	if err != nil {
 		return err
 	}
-	key, ok := privateKey.(interface {
-		Public() crypto.PublicKey
-	})
-	if !ok {
-		return fmt.Errorf("invalid private key type: %T", key)
+	publicKey, err := publicKeyFromPrivateKey(privateKey)
+	if err != nil {
+		return err
 	}
-	publicKeyPEM, err := keyutil.MarshalPublicKeyToPEM(key.Public())
+	publicKeyPEM, err := keyutil.MarshalPublicKeyToPEM(publicKey)
 	if err != nil {
 		return err
 	}
 	return writeToFile(conf.OutputFile, publicKeyPEM)
 }
+
+func GenerateJWKS(conf *config.AuthKeyJwksCmd) error {
+	jwks := JSONWebKeySet{
+		Keys: make([]JSONWebKey, 0, len(conf.InputFiles)),
+	}
+	for _, inputFile := range conf.InputFiles {
+		publicKey, err := keyutil.ReadPublicKeyFile(inputFile)
+		if err != nil {
+			return err
+		}
+		jwk, err := NewJSONWebKey(publicKey, "")
+		if err != nil {
+			return fmt.Errorf("public key %s: %w", inputFile, err)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	content, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeToFile(conf.OutputFile, append(content, '\n'))
+}
+
 func GenerateJWTToken(conf *config.AuthJwtTokenCmd) error {
 	privateKey, err := keyutil.ReadPrivateKeyFile(conf.InputFile)
 	if err != nil {
@@ -47,10 +69,25 @@ func GenerateJWTToken(conf *config.AuthJwtTokenCmd) error {
 	if err != nil {
 		return err
 	}
+	kid := conf.KeyID
+	if kid == "" {
+		publicKey, err := publicKeyFromPrivateKey(privateKey)
+		if err != nil {
+			return err
+		}
+		kid, err = KeyIDFromPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+	}
 	signer := NewTokenSigner(alg, privateKey, conf.AgentID,
+		WithKeyID(kid),
 		WithSignerAudience(conf.Audience),
 		WithTokenDuration(conf.Duration),
-		WithRole(Role(conf.Role)))
+		WithRole(Role(conf.Role)),
+		WithAgentIDs(conf.AgentIDs),
+		WithSubject(conf.Subject),
+		WithGroups(conf.Groups))
 
 	tokenString, err := signer.SignToken()
 	if err != nil {
@@ -93,6 +130,16 @@ func generateKeys(alg TokenAlg) (crypto.PrivateKey, []byte, crypto.PublicKey, []
 	}
 }
 
+func publicKeyFromPrivateKey(privateKey crypto.PrivateKey) (crypto.PublicKey, error) {
+	key, ok := privateKey.(interface {
+		Public() crypto.PublicKey
+	})
+	if !ok {
+		return nil, fmt.Errorf("invalid private key type: %T", privateKey)
+	}
+	return key.Public(), nil
+}
+
 func tokenAlgFromPrivateKey(privateKey crypto.PrivateKey) (TokenAlg, error) {
 	switch privateKey.(type) {
 	case *ecdsa.PrivateKey:
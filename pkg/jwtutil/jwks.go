@@ -0,0 +1,350 @@
+package jwtutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+)
+
+const (
+	DefaultJWKSRefresh = 5 * time.Minute
+	// minJWKSRefresh limits refreshes triggered by tokens with unknown key id.
+	minJWKSRefresh     = 10 * time.Second
+	defaultJWKSTimeout = 10 * time.Second
+	maxJWKSLength      = 1024 * 1024
+)
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey creates a JWK for the public key, an empty kid is replaced by the key thumbprint.
+func NewJSONWebKey(publicKey crypto.PublicKey, kid string) (JSONWebKey, error) {
+	var jwk JSONWebKey
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return jwk, fmt.Errorf("unsupported curve: %s", key.Curve.Params().Name)
+		}
+		jwk = JSONWebKey{
+			Kty: "EC",
+			Alg: string(ES256),
+			Crv: "P-256",
+			X:   encodeBigInt(key.X, 32),
+			Y:   encodeBigInt(key.Y, 32),
+		}
+	case *rsa.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "RSA",
+			Alg: string(RS256),
+			N:   encodeBigInt(key.N, 0),
+			E:   encodeBigInt(big.NewInt(int64(key.E)), 0),
+		}
+	default:
+		return jwk, fmt.Errorf("public key is not a recognized type: %T", publicKey)
+	}
+	jwk.Use = "sig"
+	if kid == "" {
+		kid = jwk.Thumbprint()
+	}
+	jwk.Kid = kid
+	return jwk, nil
+}
+
+// Thumbprint returns RFC 7638 JWK thumbprint.
+func (k JSONWebKey) Thumbprint() string {
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	default:
+		return ""
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return key, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// KeyIDFromPublicKey returns the thumbprint used as key id of the public key.
+func KeyIDFromPublicKey(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := NewJSONWebKey(publicKey, "")
+	if err != nil {
+		return "", err
+	}
+	return jwk.Kid, nil
+}
+
+func encodeBigInt(i *big.Int, size int) string {
+	bs := i.Bytes()
+	if len(bs) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(bs):], bs)
+		bs = padded
+	}
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("empty value")
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
+
+// KeySet provides public keys for the token verification.
+type KeySet interface {
+	// PublicKeys returns the key with the kid or all keys if kid is empty.
+	PublicKeys(ctx context.Context, kid string) ([]crypto.PublicKey, error)
+}
+
+type JWKSKeySetOption func(*jwksKeySet)
+
+func WithJWKSRefresh(refresh time.Duration) JWKSKeySetOption {
+	return func(s *jwksKeySet) {
+		s.refresh = refresh
+	}
+}
+
+func WithJWKSHttpClient(httpClient *http.Client) JWKSKeySetOption {
+	return func(s *jwksKeySet) {
+		s.httpClient = httpClient
+	}
+}
+
+type jwksKeySet struct {
+	source     string
+	refresh    time.Duration
+	httpClient *http.Client
+	logger     *logger.Logger
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	// loading is closed when the reload in progress finishes
+	loading chan struct{}
+}
+
+// NewJWKSKeySet creates a key set from the JWKS file or http(s) URL. The keys are reloaded in the background after
+// the refresh interval, the previous keys are used meanwhile. A token signed with an unknown key id waits for the reload.
+func NewJWKSKeySet(source string, opts ...JWKSKeySetOption) (KeySet, error) {
+	s := &jwksKeySet{
+		source:     source,
+		refresh:    DefaultJWKSRefresh,
+		httpClient: &http.Client{Timeout: defaultJWKSTimeout},
+		logger:     logger.GetInstance().WithFields(map[string]any{"kind": "jwks"}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.attemptedAt = time.Now()
+	keys, err := s.fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	s.loadedAt = s.attemptedAt
+	return s, nil
+}
+
+func (s *jwksKeySet) PublicKeys(ctx context.Context, kid string) ([]crypto.PublicKey, error) {
+	s.mu.Lock()
+	now := time.Now()
+	_, known := s.keys[kid]
+	retryAfter := minJWKSRefresh
+	if s.refresh > 0 {
+		retryAfter = min(s.refresh, minJWKSRefresh)
+		if now.Sub(s.loadedAt) > s.refresh && now.Sub(s.attemptedAt) > retryAfter {
+			s.startLoad()
+		}
+	}
+	var loading chan struct{}
+	if kid != "" && !known && (s.loading != nil || now.Sub(s.attemptedAt) > minJWKSRefresh) {
+		loading = s.startLoad()
+	}
+	s.mu.Unlock()
+
+	if loading != nil {
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if kid != "" {
+		if key, ok := s.keys[kid]; ok {
+			return []crypto.PublicKey{key}, nil
+		}
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	keys := make([]crypto.PublicKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// startLoad starts the reload unless a reload is in progress and returns its done channel. It must be called with
+// the lock held, the keys are fetched without the lock.
+func (s *jwksKeySet) startLoad() chan struct{} {
+	if s.loading != nil {
+		return s.loading
+	}
+	loading := make(chan struct{})
+	s.loading = loading
+	s.attemptedAt = time.Now()
+	attemptedAt := s.attemptedAt
+	go func() {
+		defer close(loading)
+		ctx, cancel := context.WithTimeout(context.Background(), defaultJWKSTimeout)
+		defer cancel()
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.loading = nil
+		if err != nil {
+			s.logger.Warnf("jwks refresh failed, using previous keys: %v", err)
+			return
+		}
+		s.keys = keys
+		s.loadedAt = attemptedAt
+	}()
+	return loading
+}
+
+// fetch reads and parses the key set.
+func (s *jwksKeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks %s: %w", s.source, err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwks %s: %w", s.source, err)
+	}
+	s.logger.Debugf("loaded %d keys from %s", len(keys), s.source)
+	return keys, nil
+}
+
+func (s *jwksKeySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "https://") && !strings.HasPrefix(s.source, "http://") {
+		return os.ReadFile(s.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSLength))
+}
+
+// ParseJWKS returns the supported signing keys by key id. Keys without kid are indexed by the thumbprint.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var jwks JSONWebKeySet
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Alg != "" && jwk.Alg != string(RS256) && jwk.Alg != string(ES256) {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		kid := jwk.Kid
+		if kid == "" {
+			kid = jwk.Thumbprint()
+		}
+		keys[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
@@ -0,0 +1,162 @@
+package jwtutil
+
+import (
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	_, _, ecPubKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	_, _, rsaPubKey, _, err := keyutil.GenerateRSAKeys()
+	require.NoError(t, err)
+
+	for _, pubKey := range []crypto.PublicKey{ecPubKey, rsaPubKey} {
+		jwk, err := NewJSONWebKey(pubKey, "")
+		require.NoError(t, err)
+		require.NotEmpty(t, jwk.Kid)
+		require.Equal(t, jwk.Thumbprint(), jwk.Kid)
+
+		data, err := json.Marshal(JSONWebKeySet{Keys: []JSONWebKey{jwk}})
+		require.NoError(t, err)
+		keys, err := ParseJWKS(data)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		require.True(t, keys[jwk.Kid].(interface{ Equal(crypto.PublicKey) bool }).Equal(pubKey))
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	privKey1, _, pubKey1, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	privKey2, _, pubKey2, _, err := keyutil.GenerateRSAKeys()
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, pubKey1)
+
+	keySet, err := NewJWKSKeySet(jwksFile, WithJWKSRefresh(time.Nanosecond))
+	require.NoError(t, err)
+	verifier := NewKeySetTokenVerifier(keySet)
+
+	token1 := signWithKid(t, ES256, privKey1, pubKey1)
+	token2 := signWithKid(t, RS256, privKey2, pubKey2)
+
+	_, err = verifier.VerifyToken(token1)
+	require.NoError(t, err)
+	_, err = verifier.VerifyToken(token2)
+	require.ErrorContains(t, err, "unknown key id")
+
+	// rotation: both keys are valid
+	writeJWKS(t, jwksFile, pubKey1, pubKey2)
+	_, err = verifier.VerifyToken(token1)
+	require.NoError(t, err)
+	_, err = verifier.VerifyToken(token2)
+	require.NoError(t, err)
+
+	// tokens without kid are verified with all keys
+	tokenNoKid, err := NewTokenSigner(ES256, privKey1, "4711").SignToken()
+	require.NoError(t, err)
+	_, err = verifier.VerifyToken(tokenNoKid)
+	require.NoError(t, err)
+
+	// old key removed, the previous keys are used until the background refresh finishes
+	writeJWKS(t, jwksFile, pubKey2)
+	require.Eventually(t, func() bool {
+		_, err = verifier.VerifyToken(token1)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	require.ErrorContains(t, err, "unknown key id")
+	_, err = verifier.VerifyToken(token2)
+	require.NoError(t, err)
+
+	// invalid document keeps the previous keys
+	require.NoError(t, os.WriteFile(jwksFile, []byte("invalid"), 0600))
+	for i := 0; i < 3; i++ {
+		_, err = verifier.VerifyToken(token2)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJWKSSlowRefresh(t *testing.T) {
+	privKey, _, pubKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	jwk, err := NewJSONWebKey(pubKey, "")
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{jwk}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	keySet, err := NewJWKSKeySet(server.URL, WithJWKSRefresh(time.Nanosecond))
+	require.NoError(t, err)
+	verifier := NewKeySetTokenVerifier(keySet)
+	token := signWithKid(t, ES256, privKey, pubKey)
+
+	// the stalled refresh does not block the verification with the known key
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		_, err = verifier.VerifyToken(token)
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), time.Second)
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 2 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(2), requests.Load())
+}
+
+func TestJWKSFromURL(t *testing.T) {
+	privKey, _, pubKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	jwk, err := NewJSONWebKey(pubKey, "")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{jwk}})
+	}))
+	defer server.Close()
+
+	keySet, err := NewJWKSKeySet(server.URL)
+	require.NoError(t, err)
+	claims, err := NewKeySetTokenVerifier(keySet).VerifyToken(signWithKid(t, ES256, privKey, pubKey))
+	require.NoError(t, err)
+	require.Equal(t, "4711", claims.AgentID)
+}
+
+func signWithKid(t *testing.T, alg TokenAlg, privKey crypto.PrivateKey, pubKey crypto.PublicKey) string {
+	kid, err := KeyIDFromPublicKey(pubKey)
+	require.NoError(t, err)
+	token, err := NewTokenSigner(alg, privKey, "4711", WithKeyID(kid)).SignToken()
+	require.NoError(t, err)
+	return token
+}
+
+func writeJWKS(t *testing.T, filename string, pubKeys ...crypto.PublicKey) {
+	var jwks JSONWebKeySet
+	for _, pubKey := range pubKeys {
+		jwk, err := NewJSONWebKey(pubKey, "")
+		require.NoError(t, err)
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, data, 0600))
+}
@@ -1,9 +1,11 @@
 package jwtutil
 
 import (
+	"context"
 	"crypto"
 	"errors"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -28,11 +30,42 @@ const (
 const DefaultTokenDuration = 30 * 24 * time.Hour
 
 type TokenClaims struct {
-	AgentID string `json:"agent_id"`
-	Role    string `json:"role"`
+	AgentID  string   `json:"agent_id,omitempty"`
+	AgentIDs []string `json:"agent_ids,omitempty"`
+	Role     string   `json:"role"`
+	Groups   []string `json:"groups,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// HasAgents returns true if the token is restricted to agents by agent_id or agent_ids claims.
+func (c *TokenClaims) HasAgents() bool {
+	return c.AgentID != "" || len(c.AgentIDs) != 0
+}
+
+// MatchAgent checks the agent against agent_id claim and agent_ids claim, which can contain glob patterns.
+func (c *TokenClaims) MatchAgent(agentID string) bool {
+	if agentID == "" {
+		return false
+	}
+	if c.AgentID == agentID {
+		return true
+	}
+	return MatchAgentPatterns(c.AgentIDs, agentID)
+}
+
+// MatchAgentPatterns checks if the agent matches any of the glob patterns.
+func MatchAgentPatterns(patterns []string, agentID string) bool {
+	if agentID == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, agentID); ok {
+			return true
+		}
+	}
+	return false
+}
+
 type TokenSignerOption func(*tokenSigner)
 
 func WithTokenDuration(duration time.Duration) func(*tokenSigner) {
@@ -52,13 +85,41 @@ func WithSignerAudience(audience string) func(*tokenSigner) {
 	}
 }
 
+func WithSubject(subject string) func(*tokenSigner) {
+	return func(s *tokenSigner) {
+		s.subject = subject
+	}
+}
+
+func WithKeyID(kid string) func(*tokenSigner) {
+	return func(s *tokenSigner) {
+		s.kid = kid
+	}
+}
+
+func WithAgentIDs(agentIDs []string) func(*tokenSigner) {
+	return func(s *tokenSigner) {
+		s.agentIDs = agentIDs
+	}
+}
+
+func WithGroups(groups []string) func(*tokenSigner) {
+	return func(s *tokenSigner) {
+		s.groups = groups
+	}
+}
+
 type tokenSigner struct {
 	privateKey crypto.PrivateKey
 	alg        TokenAlg
 	agentID    string
+	agentIDs   []string
 	duration   time.Duration
 	audience   string
 	role       Role
+	subject    string
+	groups     []string
+	kid        string
 }
 
 type TokenSigner interface {
@@ -84,19 +145,30 @@ func (s tokenSigner) SignToken() (string, error) {
 	if method == nil {
 		return "", fmt.Errorf("unknown signing method: %s", s.alg)
 	}
-	if s.agentID == "" {
-		return "", errors.New("agentID is empty")
+	if s.agentID == "" && len(s.agentIDs) == 0 && s.subject == "" {
+		return "", errors.New("agentID, agentIDs and subject are empty")
+	}
+	for _, pattern := range s.agentIDs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", fmt.Errorf("invalid agentIDs pattern %s: %w", pattern, err)
+		}
+	}
+	subject := s.subject
+	if subject == "" {
+		subject = s.agentID
 	}
 	now := time.Now()
 	claims := TokenClaims{
-		AgentID: s.agentID,
-		Role:    string(s.role),
+		AgentID:  s.agentID,
+		AgentIDs: s.agentIDs,
+		Role:     string(s.role),
+		Groups:   s.groups,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.duration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "reverse-http",
-			Subject:   s.agentID,
+			Subject:   subject,
 			ID:        uuid.New().String(),
 		},
 	}
@@ -104,6 +176,9 @@ func (s tokenSigner) SignToken() (string, error) {
 		claims.RegisteredClaims.Audience = []string{s.audience}
 	}
 	token := jwt.NewWithClaims(method, claims)
+	if s.kid != "" {
+		token.Header["kid"] = s.kid
+	}
 	return token.SignedString(s.privateKey)
 }
 
@@ -115,9 +190,22 @@ func WithVerifierAudience(audience string) func(*tokenVerifier) {
 	}
 }
 
+// RevocationList contains the IDs (jti) of revoked tokens.
+type RevocationList interface {
+	IsRevoked(tokenID string) bool
+}
+
+func WithVerifierRevocationList(revocationList RevocationList) func(*tokenVerifier) {
+	return func(s *tokenVerifier) {
+		s.revocationList = revocationList
+	}
+}
+
 type tokenVerifier struct {
-	publicKey crypto.PublicKey
-	audience  string
+	publicKey      crypto.PublicKey
+	keySet         KeySet
+	audience       string
+	revocationList RevocationList
 }
 
 type TokenVerifier interface {
@@ -134,10 +222,40 @@ func NewTokenVerifier(publicKey crypto.PublicKey, opts ...TokenVerifierOption) T
 	return t
 }
 
+// NewKeySetTokenVerifier creates a verifier selecting the public key by the kid header of the token.
+func NewKeySetTokenVerifier(keySet KeySet, opts ...TokenVerifierOption) TokenVerifier {
+	t := &tokenVerifier{
+		keySet: keySet,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// KeySetKeyFunc returns jwt.Keyfunc selecting the keys by the kid header of the token.
+func KeySetKeyFunc(keySet KeySet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		keys, err := keySet.PublicKeys(context.Background(), kid)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys := make([]jwt.VerificationKey, 0, len(keys))
+		for _, key := range keys {
+			verificationKeys = append(verificationKeys, key)
+		}
+		return jwt.VerificationKeySet{Keys: verificationKeys}, nil
+	}
+}
+
 func (s tokenVerifier) VerifyToken(tokenString string) (*TokenClaims, error) {
 	keyFunc := func(*jwt.Token) (interface{}, error) {
 		return s.publicKey, nil
 	}
+	if s.keySet != nil {
+		keyFunc = KeySetKeyFunc(s.keySet)
+	}
 	opts := []jwt.ParserOption{
 		jwt.WithValidMethods([]string{string(RS256), string(ES256)}),
 		jwt.WithLeeway(5 * time.Second),
@@ -150,6 +268,9 @@ func (s tokenVerifier) VerifyToken(tokenString string) (*TokenClaims, error) {
 		return nil, err
 	}
 	if claims, ok := token.Claims.(*TokenClaims); ok {
+		if s.revocationList != nil && s.revocationList.IsRevoked(claims.ID) {
+			return nil, fmt.Errorf("token %s is revoked", claims.ID)
+		}
 		return claims, nil
 	}
 	return nil, errors.New("unknown claims type")
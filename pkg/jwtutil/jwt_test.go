@@ -52,6 +52,11 @@ func testSignAndVerify(t *testing.T, alg TokenAlg, privKey crypto.PrivateKey, pu
 			signer:   NewTokenSigner(alg, privKey, "4711", WithTokenDuration(60*time.Second)).(*tokenSigner),
 			verifier: NewTokenVerifier(pubKey).(*tokenVerifier),
 		},
+		{
+			name:     "sign with subject and groups",
+			signer:   NewTokenSigner(alg, privKey, "", WithSubject("alice"), WithGroups([]string{"sre"})).(*tokenSigner),
+			verifier: NewTokenVerifier(pubKey).(*tokenVerifier),
+		},
 		{
 			name:        "sign with missing audience",
 			signer:      NewTokenSigner(alg, privKey, "4711").(*tokenSigner),
@@ -86,6 +91,92 @@ func testSignAndVerify(t *testing.T, alg TokenAlg, privKey crypto.PrivateKey, pu
 			require.NotNil(t, claims)
 			require.Equal(t, claims.AgentID, tc.signer.agentID)
 			require.Equal(t, claims.Role, string(tc.signer.role))
+			require.Equal(t, claims.Groups, tc.signer.groups)
+			if tc.signer.subject != "" {
+				require.Equal(t, claims.Subject, tc.signer.subject)
+			} else {
+				require.Equal(t, claims.Subject, tc.signer.agentID)
+			}
+		})
+	}
+}
+
+func TestMatchAgent(t *testing.T) {
+	privKey, _, pubKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		signer  TokenSigner
+		allowed []string
+		blocked []string
+	}{
+		{
+			name:    "single agent",
+			signer:  NewTokenSigner(ES256, privKey, "4711"),
+			allowed: []string{"4711"},
+			blocked: []string{"", "4712", "47*"},
+		},
+		{
+			name:    "agent list",
+			signer:  NewTokenSigner(ES256, privKey, "", WithAgentIDs([]string{"4711", "4712"})),
+			allowed: []string{"4711", "4712"},
+			blocked: []string{"", "4713"},
+		},
+		{
+			name:    "agent patterns",
+			signer:  NewTokenSigner(ES256, privKey, "4711", WithAgentIDs([]string{"site-eu-*", "site-us-?"})),
+			allowed: []string{"4711", "site-eu-1", "site-eu-berlin", "site-us-1"},
+			blocked: []string{"", "4712", "site-us-10", "site-asia-1"},
+		},
+	}
+	verifier := NewTokenVerifier(pubKey)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenString, err := tc.signer.SignToken()
+			require.NoError(t, err)
+			claims, err := verifier.VerifyToken(tokenString)
+			require.NoError(t, err)
+			require.True(t, claims.HasAgents())
+
+			for _, agentID := range tc.allowed {
+				require.True(t, claims.MatchAgent(agentID), "agent %s should match", agentID)
+			}
+			for _, agentID := range tc.blocked {
+				require.False(t, claims.MatchAgent(agentID), "agent %s should not match", agentID)
+			}
 		})
 	}
 }
+
+func TestSignInvalidAgentPattern(t *testing.T) {
+	privKey, _, _, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	_, err = NewTokenSigner(ES256, privKey, "", WithAgentIDs([]string{"site-["})).SignToken()
+	require.ErrorContains(t, err, "invalid agentIDs pattern")
+}
+
+type testRevocationList map[string]bool
+
+func (l testRevocationList) IsRevoked(tokenID string) bool {
+	return l[tokenID]
+}
+
+func TestVerifyRevokedToken(t *testing.T) {
+	privKey, _, pubKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	signer := NewTokenSigner(ES256, privKey, "4711")
+	revokedToken, err := signer.SignToken()
+	require.NoError(t, err)
+	validToken, err := signer.SignToken()
+	require.NoError(t, err)
+
+	claims, err := NewTokenVerifier(pubKey).VerifyToken(revokedToken)
+	require.NoError(t, err)
+
+	verifier := NewTokenVerifier(pubKey, WithVerifierRevocationList(testRevocationList{claims.ID: true}))
+	_, err = verifier.VerifyToken(revokedToken)
+	require.ErrorContains(t, err, "is revoked")
+	_, err = verifier.VerifyToken(validToken)
+	require.NoError(t, err)
+}
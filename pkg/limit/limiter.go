@@ -0,0 +1,316 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// concurrencyRetryAfter is suggested to the clients rejected by the concurrency limits.
+	concurrencyRetryAfter = time.Second
+	// idleLimiterTTL is the time after which unused client rate limiters are removed.
+	idleLimiterTTL = 10 * time.Minute
+)
+
+type Config struct {
+	// MaxTunnelsPerAgent is the maximal number of concurrent tunnels to an agent.
+	MaxTunnelsPerAgent int
+	// MaxTunnelsPerClient is the maximal number of concurrent tunnels of a client identity.
+	MaxTunnelsPerClient int
+	// TunnelRate is the number of new tunnels per second of a client identity.
+	TunnelRate float64
+	// TunnelBurst is the bucket size of the new tunnel rate.
+	TunnelBurst int
+	// AgentBandwidth is the maximal number of bytes per second of all tunnels to an agent.
+	AgentBandwidth int64
+}
+
+type clientRate struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+type agentBandwidth struct {
+	limiter *rate.Limiter
+	tunnels int
+}
+
+// Limiter limits the concurrent tunnels per agent and client, the new tunnel rate per client
+// and the bandwidth per agent.
+type Limiter struct {
+	conf Config
+
+	mu            sync.Mutex
+	agentTunnels  map[string]int
+	clientTunnels map[string]int
+	clientRates   map[string]*clientRate
+	bandwidths    map[string]*agentBandwidth
+	sweptAt       time.Time
+}
+
+func NewLimiter(conf Config) *Limiter {
+	if conf.TunnelRate > 0 && conf.TunnelBurst <= 0 {
+		conf.TunnelBurst = int(math.Max(1, math.Ceil(conf.TunnelRate)))
+	}
+	return &Limiter{
+		conf:          conf,
+		agentTunnels:  make(map[string]int),
+		clientTunnels: make(map[string]int),
+		clientRates:   make(map[string]*clientRate),
+		bandwidths:    make(map[string]*agentBandwidth),
+		sweptAt:       time.Now(),
+	}
+}
+
+// Enabled returns true if any limit is configured.
+func (c Config) Enabled() bool {
+	return c.MaxTunnelsPerAgent > 0 || c.MaxTunnelsPerClient > 0 || c.TunnelRate > 0 || c.AgentBandwidth > 0
+}
+
+// clientKey identifies the client by the identity subject, the proxy user or the source IP.
+func clientKey(ctx context.Context) string {
+	if identity := gost.ClientIdentityFromContext(ctx); identity != nil && identity.Subject != "" {
+		return "subject:" + identity.Subject
+	}
+	if auth := gost.ProxyAuthorizationFromContext(ctx); auth != nil && auth.Username() != "" {
+		return "user:" + auth.Username()
+	}
+	if addr := gost.SrcAddrFromContext(ctx); addr != nil {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			return "ip:" + host
+		}
+	}
+	return ""
+}
+
+func (l *Limiter) Reserve(ctx context.Context, _, _ string) (gost.Reservation, error) {
+	agentID := string(gost.ClientIDFromContext(ctx))
+	client := clientKey(ctx)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	if l.conf.MaxTunnelsPerAgent > 0 && l.agentTunnels[agentID] >= l.conf.MaxTunnelsPerAgent {
+		return nil, &gost.LimitExceededError{
+			Reason:     fmt.Sprintf("agent %s has %d concurrent tunnels", agentID, l.conf.MaxTunnelsPerAgent),
+			RetryAfter: concurrencyRetryAfter,
+		}
+	}
+	if l.conf.MaxTunnelsPerClient > 0 && l.clientTunnels[client] >= l.conf.MaxTunnelsPerClient {
+		return nil, &gost.LimitExceededError{
+			Reason:     fmt.Sprintf("client %s has %d concurrent tunnels", client, l.conf.MaxTunnelsPerClient),
+			RetryAfter: concurrencyRetryAfter,
+		}
+	}
+	if l.conf.TunnelRate > 0 {
+		cr, ok := l.clientRates[client]
+		if !ok {
+			cr = &clientRate{limiter: rate.NewLimiter(rate.Limit(l.conf.TunnelRate), l.conf.TunnelBurst)}
+			l.clientRates[client] = cr
+		}
+		cr.lastUsed = now
+		r := cr.limiter.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			return nil, &gost.LimitExceededError{
+				Reason:     fmt.Sprintf("client %s exceeded the tunnel rate %g/s", client, l.conf.TunnelRate),
+				RetryAfter: delay,
+			}
+		}
+	}
+	l.agentTunnels[agentID]++
+	l.clientTunnels[client]++
+
+	res := &reservation{limiter: l, agentID: agentID, client: client}
+	if l.conf.AgentBandwidth > 0 {
+		bw, ok := l.bandwidths[agentID]
+		if !ok {
+			bw = &agentBandwidth{limiter: rate.NewLimiter(rate.Limit(l.conf.AgentBandwidth), int(l.conf.AgentBandwidth))}
+			l.bandwidths[agentID] = bw
+		}
+		bw.tunnels++
+		res.bandwidth = bw.limiter
+	}
+	return res, nil
+}
+
+// sweep removes the rate limiters of inactive clients.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < idleLimiterTTL {
+		return
+	}
+	l.sweptAt = now
+	for client, cr := range l.clientRates {
+		if now.Sub(cr.lastUsed) > idleLimiterTTL {
+			delete(l.clientRates, client)
+		}
+	}
+}
+
+func (l *Limiter) release(r *reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.agentTunnels[r.agentID]--; l.agentTunnels[r.agentID] <= 0 {
+		delete(l.agentTunnels, r.agentID)
+	}
+	if l.clientTunnels[r.client]--; l.clientTunnels[r.client] <= 0 {
+		delete(l.clientTunnels, r.client)
+	}
+	if bw, ok := l.bandwidths[r.agentID]; ok && r.bandwidth != nil {
+		if bw.tunnels--; bw.tunnels <= 0 {
+			delete(l.bandwidths, r.agentID)
+		}
+	}
+}
+
+type reservation struct {
+	limiter   *Limiter
+	agentID   string
+	client    string
+	bandwidth *rate.Limiter
+	once      sync.Once
+}
+
+func (r *reservation) Wrap(conn net.Conn) net.Conn {
+	if r.bandwidth == nil {
+		return conn
+	}
+	return &throttledConn{Conn: conn, limiter: r.bandwidth, changed: make(chan struct{})}
+}
+
+func (r *reservation) Release() {
+	r.once.Do(func() {
+		r.limiter.release(r)
+	})
+}
+
+// throttledConn limits the bytes read and written with the shared limiter. The waits are stopped by the
+// deadlines and the close of the connection e.g. by the tunnel limits.
+type throttledConn struct {
+	net.Conn
+	limiter *rate.Limiter
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closed        bool
+	changed       chan struct{} // closed on the deadline changes and the close
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if burst := c.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := c.Conn.Read(p)
+	if waitErr := c.wait(n, false); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	written := 0
+	burst := c.limiter.Burst()
+	for written < len(p) {
+		chunk := p[written:min(written+burst, len(p))]
+		if err := c.wait(len(chunk), true); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// wait blocks until the limiter allows n bytes, the deadline or the close of the connection.
+func (c *throttledConn) wait(n int, write bool) error {
+	if n <= 0 {
+		return nil
+	}
+	r := c.limiter.ReserveN(time.Now(), n)
+	until := time.Now().Add(r.Delay())
+	for {
+		c.mu.Lock()
+		closed, changed, deadline := c.closed, c.changed, c.readDeadline
+		if write {
+			deadline = c.writeDeadline
+		}
+		c.mu.Unlock()
+
+		now := time.Now()
+		switch {
+		case closed:
+			r.Cancel()
+			return net.ErrClosed
+		case !deadline.IsZero() && !deadline.After(now):
+			r.Cancel()
+			return os.ErrDeadlineExceeded
+		case !until.After(now):
+			return nil
+		}
+		wake := until
+		if !deadline.IsZero() && deadline.Before(wake) {
+			wake = deadline
+		}
+		timer := time.NewTimer(wake.Sub(now))
+		select {
+		case <-timer.C:
+		case <-changed:
+		}
+		timer.Stop()
+	}
+}
+
+// update changes the state under the lock and wakes up the waits.
+func (c *throttledConn) update(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f()
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *throttledConn) SetDeadline(t time.Time) error {
+	c.update(func() {
+		c.readDeadline = t
+		c.writeDeadline = t
+	})
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *throttledConn) SetReadDeadline(t time.Time) error {
+	c.update(func() { c.readDeadline = t })
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *throttledConn) SetWriteDeadline(t time.Time) error {
+	c.update(func() { c.writeDeadline = t })
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *throttledConn) Close() error {
+	c.update(func() { c.closed = true })
+	return c.Conn.Close()
+}
+
+func (c *throttledConn) CloseWrite() error {
+	if conn, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
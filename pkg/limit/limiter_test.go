@@ -0,0 +1,126 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/stretchr/testify/require"
+)
+
+func clientContext(agentID, subject string) context.Context {
+	ctx := gost.ContextWithClientID(context.Background(), gost.ClientID(agentID))
+	return gost.ContextWithClientIdentity(ctx, &gost.ClientIdentity{Subject: subject})
+}
+
+func requireLimitExceeded(t *testing.T, err error) *gost.LimitExceededError {
+	var limitErr *gost.LimitExceededError
+	require.True(t, errors.As(err, &limitErr), "expected limit error: %v", err)
+	require.Greater(t, limitErr.RetryAfter, time.Duration(0))
+	return limitErr
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	l := NewLimiter(Config{MaxTunnelsPerAgent: 2, MaxTunnelsPerClient: 1})
+
+	r1, err := l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+	_, err = l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+	require.ErrorContains(t, err, "client subject:alice")
+	requireLimitExceeded(t, err)
+
+	r2, err := l.Reserve(clientContext("4711", "bob"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+	_, err = l.Reserve(clientContext("4711", "carol"), "tcp", "httpbin.org:443")
+	require.ErrorContains(t, err, "agent 4711")
+
+	// other agent is not limited
+	r3, err := l.Reserve(clientContext("4712", "carol"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+
+	r1.Release()
+	r1.Release()
+	_, err = l.Reserve(clientContext("4711", "dave"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+
+	r2.Release()
+	r3.Release()
+}
+
+func TestTunnelRate(t *testing.T) {
+	l := NewLimiter(Config{TunnelRate: 1, TunnelBurst: 2})
+	for i := 0; i < 2; i++ {
+		r, err := l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+		require.NoError(t, err)
+		r.Release()
+	}
+	_, err := l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+	limitErr := requireLimitExceeded(t, err)
+	require.LessOrEqual(t, limitErr.RetryAfter, time.Second)
+
+	// rate is per client
+	_, err = l.Reserve(clientContext("4711", "bob"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+}
+
+func TestAgentBandwidth(t *testing.T) {
+	const bandwidth = 64 * 1024
+	l := NewLimiter(Config{AgentBandwidth: bandwidth})
+	r, err := l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+	require.NoError(t, err)
+	defer r.Release()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := r.Wrap(client)
+	defer conn.Close()
+
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+	// the first burst is free, the second one waits for a second
+	start := time.Now()
+	_, err = conn.Write(make([]byte, 2*bandwidth))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestAgentBandwidthAbort(t *testing.T) {
+	const bandwidth = 64 * 1024
+	tests := []struct {
+		name  string
+		abort func(conn net.Conn)
+		err   error
+	}{
+		{name: "deadline", abort: func(conn net.Conn) { _ = conn.SetDeadline(time.Now()) }, err: os.ErrDeadlineExceeded},
+		{name: "close", abort: func(conn net.Conn) { _ = conn.Close() }, err: net.ErrClosed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(Config{AgentBandwidth: bandwidth})
+			r, err := l.Reserve(clientContext("4711", "alice"), "tcp", "httpbin.org:443")
+			require.NoError(t, err)
+			defer r.Release()
+
+			client, server := net.Pipe()
+			defer server.Close()
+			conn := r.Wrap(client)
+			defer conn.Close()
+
+			go func() {
+				_, _ = io.Copy(io.Discard, server)
+			}()
+			// the throttled write waits for several seconds unless it is aborted
+			time.AfterFunc(100*time.Millisecond, func() { tc.abort(conn) })
+			start := time.Now()
+			_, err = conn.Write(make([]byte, 10*bandwidth))
+			require.ErrorIs(t, err, tc.err)
+			require.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
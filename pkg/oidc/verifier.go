@@ -0,0 +1,203 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/grepplabs/reverse-http/pkg/jwtutil"
+)
+
+const (
+	discoveryPath      = "/.well-known/openid-configuration"
+	defaultHttpTimeout = 10 * time.Second
+	maxDiscoveryLength = 1024 * 1024
+)
+
+var supportedAlgs = []string{string(jwtutil.RS256), string(jwtutil.ES256)}
+
+type Claims struct {
+	Subject   string
+	AgentIDs  []string
+	Groups    []string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// MatchAgent checks the agent against agent IDs or glob patterns from the agents claim.
+func (c *Claims) MatchAgent(agentID string) bool {
+	return jwtutil.MatchAgentPatterns(c.AgentIDs, agentID)
+}
+
+type VerifierOption func(*Verifier)
+
+func WithAudience(audience string) VerifierOption {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+func WithAgentsClaim(claim string) VerifierOption {
+	return func(v *Verifier) {
+		v.agentsClaim = claim
+	}
+}
+
+func WithGroupsClaim(claim string) VerifierOption {
+	return func(v *Verifier) {
+		v.groupsClaim = claim
+	}
+}
+
+func WithJWKSRefresh(refresh time.Duration) VerifierOption {
+	return func(v *Verifier) {
+		v.jwksRefresh = refresh
+	}
+}
+
+// WithRevocationList rejects the tokens with a revoked ID (jti).
+func WithRevocationList(revocationList jwtutil.RevocationList) VerifierOption {
+	return func(v *Verifier) {
+		v.revocationList = revocationList
+	}
+}
+
+func WithHttpClient(httpClient *http.Client) VerifierOption {
+	return func(v *Verifier) {
+		v.httpClient = httpClient
+	}
+}
+
+type Verifier struct {
+	issuer      string
+	audience    string
+	agentsClaim string
+	groupsClaim string
+	jwksRefresh time.Duration
+	httpClient  *http.Client
+	keySet      jwtutil.KeySet
+
+	revocationList jwtutil.RevocationList
+}
+
+type providerMetadata struct {
+	Issuer  string `json:"issuer"`
+	JwksURI string `json:"jwks_uri"`
+}
+
+// NewVerifier discovers the issuer configuration and loads the issuer signing keys.
+func NewVerifier(ctx context.Context, issuer string, opts ...VerifierOption) (*Verifier, error) {
+	if issuer == "" {
+		return nil, errors.New("oidc: empty issuer")
+	}
+	v := &Verifier{
+		issuer:      issuer,
+		jwksRefresh: jwtutil.DefaultJWKSRefresh,
+		httpClient:  &http.Client{Timeout: defaultHttpTimeout},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	metadata, err := v.discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	keySet, err := jwtutil.NewJWKSKeySet(metadata.JwksURI, jwtutil.WithJWKSRefresh(v.jwksRefresh), jwtutil.WithJWKSHttpClient(v.httpClient))
+	if err != nil {
+		return nil, err
+	}
+	v.keySet = keySet
+	return v, nil
+}
+
+func (v *Verifier) discover(ctx context.Context) (*providerMetadata, error) {
+	wellKnown := strings.TrimSuffix(v.issuer, "/") + discoveryPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", wellKnown, resp.Status)
+	}
+	var metadata providerMetadata
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxDiscoveryLength)).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("%s: %w", wellKnown, err)
+	}
+	if metadata.Issuer != v.issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected %s vs discovered %s", v.issuer, metadata.Issuer)
+	}
+	if metadata.JwksURI == "" {
+		return nil, errors.New("jwks_uri is missing")
+	}
+	return &metadata, nil
+}
+
+func (v *Verifier) VerifyToken(tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(supportedAlgs),
+		jwt.WithLeeway(5 * time.Second),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, jwtutil.KeySetKeyFunc(v.keySet), opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	claims.Subject, _ = mapClaims.GetSubject()
+	claims.ID, _ = mapClaims["jti"].(string)
+	if v.revocationList != nil && claims.ID != "" && v.revocationList.IsRevoked(claims.ID) {
+		return nil, fmt.Errorf("token %s is revoked", claims.ID)
+	}
+	if exp, _ := mapClaims.GetExpirationTime(); exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if v.agentsClaim != "" {
+		if claims.AgentIDs, err = stringsClaim(mapClaims, v.agentsClaim); err != nil {
+			return nil, err
+		}
+	}
+	if v.groupsClaim != "" {
+		if claims.Groups, err = stringsClaim(mapClaims, v.groupsClaim); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// stringsClaim reads a string or a list of strings claim.
+func stringsClaim(mapClaims jwt.MapClaims, name string) ([]string, error) {
+	switch value := mapClaims[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []any:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %s: invalid item type %T", name, item)
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("claim %s: invalid type %T", name, value)
+	}
+}
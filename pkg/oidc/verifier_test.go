@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"github.com/grepplabs/reverse-http/pkg/jwtutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testIdP struct {
+	server     *httptest.Server
+	privateKey crypto.PrivateKey
+	kid        string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	privateKey, _, publicKey, _, err := keyutil.GenerateECKeys()
+	require.NoError(t, err)
+	jwk, err := jwtutil.NewJSONWebKey(publicKey, "")
+	require.NoError(t, err)
+
+	idp := &testIdP{privateKey: privateKey, kid: jwk.Kid}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":   idp.server.URL,
+			"jwks_uri": idp.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwtutil.JSONWebKeySet{Keys: []jwtutil.JSONWebKey{jwk}})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) token(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = idp.kid
+	tokenString, err := token.SignedString(idp.privateKey)
+	require.NoError(t, err)
+	return tokenString
+}
+
+func TestVerifyToken(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier, err := NewVerifier(context.Background(), idp.server.URL,
+		WithAudience("reverse-http"),
+		WithAgentsClaim("agents"),
+		WithGroupsClaim("groups"),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    idp.server.URL,
+			"aud":    "reverse-http",
+			"sub":    "alice",
+			"exp":    now.Add(time.Hour).Unix(),
+			"agents": []string{"4711", "site-eu-*"},
+			"groups": "sre",
+		}
+	}
+	tests := []struct {
+		name        string
+		claims      func() jwt.MapClaims
+		verifyError string
+	}{
+		{
+			name:   "valid token",
+			claims: validClaims,
+		},
+		{
+			name: "issuer mismatch",
+			claims: func() jwt.MapClaims {
+				c := validClaims()
+				c["iss"] = "https://other.example.com"
+				return c
+			},
+			verifyError: "token has invalid issuer",
+		},
+		{
+			name: "audience mismatch",
+			claims: func() jwt.MapClaims {
+				c := validClaims()
+				c["aud"] = "other"
+				return c
+			},
+			verifyError: "token has invalid audience",
+		},
+		{
+			name: "expired token",
+			claims: func() jwt.MapClaims {
+				c := validClaims()
+				c["exp"] = now.Add(-time.Hour).Unix()
+				return c
+			},
+			verifyError: "token is expired",
+		},
+		{
+			name: "missing expiry",
+			claims: func() jwt.MapClaims {
+				c := validClaims()
+				delete(c, "exp")
+				return c
+			},
+			verifyError: "exp claim is required",
+		},
+		{
+			name: "invalid agents claim",
+			claims: func() jwt.MapClaims {
+				c := validClaims()
+				c["agents"] = 4711
+				return c
+			},
+			verifyError: "claim agents: invalid type",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := verifier.VerifyToken(idp.token(t, tc.claims()))
+			if tc.verifyError != "" {
+				require.ErrorContains(t, err, tc.verifyError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "alice", claims.Subject)
+			require.Equal(t, []string{"sre"}, claims.Groups)
+			require.True(t, claims.MatchAgent("4711"))
+			require.True(t, claims.MatchAgent("site-eu-1"))
+			require.False(t, claims.MatchAgent("4712"))
+		})
+	}
+}
+
+func TestVerifyTokenWrongKey(t *testing.T) {
+	idp := newTestIdP(t)
+	other := newTestIdP(t)
+	verifier, err := NewVerifier(context.Background(), idp.server.URL)
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": idp.server.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = idp.kid
+	tokenString, err := token.SignedString(other.privateKey)
+	require.NoError(t, err)
+
+	_, err = verifier.VerifyToken(tokenString)
+	require.ErrorContains(t, err, "token signature is invalid")
+}
+
+type revokedIDs map[string]bool
+
+func (r revokedIDs) IsRevoked(tokenID string) bool {
+	return r[tokenID]
+}
+
+func TestVerifyTokenRevoked(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier, err := NewVerifier(context.Background(), idp.server.URL, WithRevocationList(revokedIDs{"id-1": true}))
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{"iss": idp.server.URL, "exp": time.Now().Add(time.Hour).Unix(), "jti": "id-1"}
+	_, err = verifier.VerifyToken(idp.token(t, claims))
+	require.ErrorContains(t, err, "token id-1 is revoked")
+
+	claims["jti"] = "id-2"
+	_, err = verifier.VerifyToken(idp.token(t, claims))
+	require.NoError(t, err)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	_, err := NewVerifier(context.Background(), idp.server.URL+"/")
+	require.ErrorContains(t, err, "issuer mismatch")
+}
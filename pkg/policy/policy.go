@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+const AnySubject = "*"
+
+// Rule grants the listed subjects and groups access to the agents and destinations.
+// Agents are glob patterns, destinations use the whitelist syntax and an empty list allows all destinations.
+type Rule struct {
+	Name         string   `yaml:"name"`
+	Subjects     []string `yaml:"subjects"`
+	Groups       []string `yaml:"groups"`
+	Agents       []string `yaml:"agents"`
+	Destinations []string `yaml:"destinations"`
+
+	destinations *util.Whitelist
+}
+
+type Policy struct {
+	Rules  []*Rule `yaml:"rules"`
+	logger *logger.Logger
+}
+
+func LoadFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", filename, err)
+	}
+	return p, nil
+}
+
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "policy"}),
+	}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	for i, rule := range p.Rules {
+		if rule == nil {
+			return nil, fmt.Errorf("rule %d is empty", i)
+		}
+		if len(rule.Subjects) == 0 && len(rule.Groups) == 0 {
+			return nil, fmt.Errorf("rule %d: subjects or groups are required", i)
+		}
+		if len(rule.Agents) == 0 {
+			return nil, fmt.Errorf("rule %d: agents are required", i)
+		}
+		for _, pattern := range rule.Agents {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid agent pattern %s: %w", i, pattern, err)
+			}
+		}
+		destinations, err := parseDestinations(rule.Destinations)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rule.destinations = destinations
+	}
+	return p, nil
+}
+
+// parseDestinations returns the whitelist of the destination patterns, nil for the empty list.
+func parseDestinations(patterns []string) (*util.Whitelist, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	var rules []util.Rule
+	for _, pattern := range patterns {
+		for _, entry := range strings.Split(pattern, ",") {
+			rule, err := util.ParseRule(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid destination %q: %w", entry, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	whitelist := util.NewWhitelist()
+	whitelist.SetRules(rules)
+	return whitelist, nil
+}
+
+// Authorize allows the request if any rule grants the client identity access to the agent and the destination.
+func (p *Policy) Authorize(ctx context.Context, network, addr string, opts ...gost.AuthorizeOption) error {
+	agentID := string(gost.ClientIDFromContext(ctx))
+	identity := gost.ClientIdentityFromContext(ctx)
+	if identity == nil {
+		identity = &gost.ClientIdentity{}
+	}
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	for _, rule := range p.Rules {
+		if rule.matchesIdentity(identity) && rule.matchesAgent(agentID) && rule.matchesDestination(host, port) {
+			p.logger.Debugf("subject %s granted access to agent %s and %s by rule %s", identity.Subject, agentID, addr, rule.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("subject %s is not allowed to access agent %s and %s", identity.Subject, agentID, addr)
+}
+
+func (r *Rule) matchesIdentity(identity *gost.ClientIdentity) bool {
+	for _, subject := range r.Subjects {
+		if subject == AnySubject || (subject != "" && subject == identity.Subject) {
+			return true
+		}
+	}
+	for _, group := range r.Groups {
+		if slices.Contains(identity.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesAgent(agentID string) bool {
+	if agentID == "" {
+		return false
+	}
+	for _, pattern := range r.Agents {
+		if ok, _ := path.Match(pattern, agentID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesDestination(host string, port int) bool {
+	if r.destinations == nil {
+		return true
+	}
+	return r.destinations.IsAddrAllowed(host, port)
+}
+
+func splitHostPort(addr string) (string, int, error) {
+	host, destPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(destPort)
+	if err != nil {
+		return "", 0, errors.New("invalid destination port " + destPort)
+	}
+	return host, port, nil
+}
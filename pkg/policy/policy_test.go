@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - name: sre
+    groups: ["sre"]
+    agents: ["site-eu-*", "4711"]
+  - name: alice
+    subjects: ["alice"]
+    agents: ["4712"]
+    destinations: ["*.corp.local:443", "10.0.0.0/8"]
+  - name: everyone
+    subjects: ["*"]
+    agents: ["public"]
+    destinations: ["example.com:443"]
+`
+
+func TestAuthorize(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		agentID  string
+		identity *gost.ClientIdentity
+		addr     string
+		allowed  bool
+	}{
+		{
+			name:     "group grants agent pattern",
+			agentID:  "site-eu-1",
+			identity: &gost.ClientIdentity{Subject: "bob", Groups: []string{"dev", "sre"}},
+			addr:     "db.internal:5432",
+			allowed:  true,
+		},
+		{
+			name:     "group grants exact agent",
+			agentID:  "4711",
+			identity: &gost.ClientIdentity{Subject: "bob", Groups: []string{"sre"}},
+			addr:     "db.internal:5432",
+			allowed:  true,
+		},
+		{
+			name:     "group does not grant agent",
+			agentID:  "site-us-1",
+			identity: &gost.ClientIdentity{Subject: "bob", Groups: []string{"sre"}},
+			addr:     "db.internal:5432",
+		},
+		{
+			name:     "subject grants destination zone",
+			agentID:  "4712",
+			identity: &gost.ClientIdentity{Subject: "alice"},
+			addr:     "git.corp.local:443",
+			allowed:  true,
+		},
+		{
+			name:     "subject grants destination network",
+			agentID:  "4712",
+			identity: &gost.ClientIdentity{Subject: "alice"},
+			addr:     "10.1.2.3:22",
+			allowed:  true,
+		},
+		{
+			name:     "subject does not grant destination",
+			agentID:  "4712",
+			identity: &gost.ClientIdentity{Subject: "alice"},
+			addr:     "git.corp.local:22",
+		},
+		{
+			name:     "other subject",
+			agentID:  "4712",
+			identity: &gost.ClientIdentity{Subject: "bob"},
+			addr:     "git.corp.local:443",
+		},
+		{
+			name:    "any subject",
+			agentID: "public",
+			addr:    "example.com:443",
+			allowed: true,
+		},
+		{
+			name:    "missing agent",
+			addr:    "example.com:443",
+			allowed: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := gost.ContextWithClientID(context.Background(), gost.ClientID(tc.agentID))
+			if tc.identity != nil {
+				ctx = gost.ContextWithClientIdentity(ctx, tc.identity)
+			}
+			err := p.Authorize(ctx, "tcp", tc.addr)
+			if tc.allowed {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		error  string
+	}{
+		{
+			name:   "missing subjects",
+			policy: `rules: [{agents: ["4711"]}]`,
+			error:  "subjects or groups are required",
+		},
+		{
+			name:   "missing agents",
+			policy: `rules: [{subjects: ["alice"]}]`,
+			error:  "agents are required",
+		},
+		{
+			name:   "invalid agent pattern",
+			policy: `rules: [{subjects: ["alice"], agents: ["["]}]`,
+			error:  "invalid agent pattern",
+		},
+		{
+			name:   "invalid destination",
+			policy: `rules: [{subjects: ["alice"], agents: ["4711"], destinations: ["*.corp.local:443", "10.0.0.0/33"]}, {subjects: ["bob"], agents: ["4711"], destinations: ["app.*.local"]}]`,
+			error:  `rule 0: invalid destination "10.0.0.0/33"`,
+		},
+		{
+			name:   "invalid destination of a later rule",
+			policy: `rules: [{subjects: ["alice"], agents: ["4711"]}, {subjects: ["bob"], agents: ["4711"], destinations: ["example.com:https"]}]`,
+			error:  `rule 1: invalid destination "example.com:https"`,
+		},
+		{
+			name:   "empty destination",
+			policy: `rules: [{subjects: ["alice"], agents: ["4711"], destinations: [""]}]`,
+			error:  `rule 0: invalid destination ""`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.policy))
+			require.ErrorContains(t, err, tc.error)
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package proxy
+
+type clientAuthenticatorOptions struct {
+	policyAuthorization bool
+}
+
+type ClientAuthenticatorOption func(*clientAuthenticatorOptions)
+
+// WithPolicyAuthorization accepts tokens without agent claims, the access to agents is then granted by the policy.
+func WithPolicyAuthorization() ClientAuthenticatorOption {
+	return func(o *clientAuthenticatorOptions) {
+		o.policyAuthorization = true
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/jwtutil"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ClientCertEntry maps the client certificate identity to the allowed agents (IDs or glob patterns) and groups.
+type ClientCertEntry struct {
+	Identity string   `yaml:"identity"`
+	Agents   []string `yaml:"agents"`
+	Groups   []string `yaml:"groups"`
+}
+
+type ClientCertMapping struct {
+	Clients []ClientCertEntry `yaml:"clients"`
+
+	byIdentity map[string]*ClientCertEntry
+}
+
+func LoadClientCertMapping(filename string) (*ClientCertMapping, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m := &ClientCertMapping{}
+	if err = yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("client cert mapping %s: %w", filename, err)
+	}
+	m.byIdentity = make(map[string]*ClientCertEntry, len(m.Clients))
+	for i := range m.Clients {
+		entry := &m.Clients[i]
+		if entry.Identity == "" {
+			return nil, fmt.Errorf("client cert mapping %s: entry %d: empty identity", filename, i)
+		}
+		for _, pattern := range entry.Agents {
+			if _, err = path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("client cert mapping %s: entry %d: invalid agent pattern %s: %w", filename, i, pattern, err)
+			}
+		}
+		m.byIdentity[entry.Identity] = entry
+	}
+	return m, nil
+}
+
+func (m *ClientCertMapping) Get(identity string) (*ClientCertEntry, bool) {
+	entry, ok := m.byIdentity[identity]
+	return entry, ok
+}
+
+type ClientCertAuthenticator struct {
+	extractor *util.CertIdentityExtractor
+	mapping   *ClientCertMapping
+	next      gost.Authenticator
+	logger    *logger.Logger
+	options   clientAuthenticatorOptions
+}
+
+// NewClientCertAuthenticator authenticates clients by the verified TLS client certificate. The agent is taken
+// from the Proxy-Authorization user or, if omitted, from the single agent ID of the mapping entry.
+// Clients without certificate are authenticated by the next authenticator, a nil next authenticator rejects them.
+func NewClientCertAuthenticator(extractor *util.CertIdentityExtractor, mapping *ClientCertMapping, next gost.Authenticator, opts ...ClientAuthenticatorOption) gost.Authenticator {
+	a := &ClientCertAuthenticator{
+		extractor: extractor,
+		mapping:   mapping,
+		next:      next,
+		logger:    logger.GetInstance(),
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	return a
+}
+
+func (a *ClientCertAuthenticator) Authenticate(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, ok bool) {
+	id, _, ok = a.AuthenticateIdentity(ctx, agentID, password, opts...)
+	return id, ok
+}
+
+func (a *ClientCertAuthenticator) AuthenticateIdentity(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, identity *gost.ClientIdentity, ok bool) {
+	cert := gost.PeerCertificateFromContext(ctx)
+	if cert == nil {
+		switch next := a.next.(type) {
+		case nil:
+			a.logger.Warnf("client certificate is missing: user %s", agentID)
+			return "", nil, false
+		case gost.IdentityAuthenticator:
+			return next.AuthenticateIdentity(ctx, agentID, password, opts...)
+		default:
+			id, ok = next.Authenticate(ctx, agentID, password, opts...)
+			return id, nil, ok
+		}
+	}
+	certIdentity, err := a.extractor.Identity(cert)
+	if err != nil {
+		a.logger.Warnf("client certificate identity failure: %v", err)
+		return "", nil, false
+	}
+	entry, found := a.mapping.Get(certIdentity)
+	if !found && !a.options.policyAuthorization {
+		a.logger.Warnf("client certificate identity %s is not mapped", certIdentity)
+		return "", nil, false
+	}
+	if found && len(entry.Agents) != 0 {
+		if agentID == "" && len(entry.Agents) == 1 && !strings.ContainsAny(entry.Agents[0], `*?[\`) {
+			agentID = entry.Agents[0]
+		}
+		if !jwtutil.MatchAgentPatterns(entry.Agents, agentID) {
+			a.logger.Warnf("agentID mismatch: user %s vs client certificate %s agents %v", agentID, certIdentity, entry.Agents)
+			return "", nil, false
+		}
+	} else if !a.options.policyAuthorization {
+		a.logger.Warnf("agents are missing: client certificate %s", certIdentity)
+		return "", nil, false
+	}
+	if agentID == "" {
+		return "", nil, false
+	}
+	identity = &gost.ClientIdentity{Subject: certIdentity}
+	if found {
+		identity.Groups = entry.Groups
+	}
+	return agentID, identity, true
+}
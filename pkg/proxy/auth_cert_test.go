@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testClientCertMapping = `
+clients:
+  - identity: alice
+    agents: ["4711"]
+    groups: ["sre"]
+  - identity: bob
+    agents: ["site-eu-*"]
+`
+
+type staticAuthenticator struct{}
+
+func (staticAuthenticator) Authenticate(_ context.Context, user, password string, _ ...gost.AuthOption) (string, bool) {
+	return user, password == "secret"
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(testClientCertMapping), 0600))
+	mapping, err := LoadClientCertMapping(filename)
+	require.NoError(t, err)
+	extractor, err := util.NewCertIdentityExtractor(util.CertIdentityCN, "", "")
+	require.NoError(t, err)
+
+	certFor := func(cn string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	}
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		user     string
+		password string
+		next     gost.Authenticator
+		id       string
+		ok       bool
+	}{
+		{name: "single agent from mapping", cert: certFor("alice"), id: "4711", ok: true},
+		{name: "agent from user", cert: certFor("alice"), user: "4711", id: "4711", ok: true},
+		{name: "agent not allowed", cert: certFor("alice"), user: "4712"},
+		{name: "agent pattern", cert: certFor("bob"), user: "site-eu-1", id: "site-eu-1", ok: true},
+		{name: "agent pattern requires user", cert: certFor("bob")},
+		{name: "unmapped identity", cert: certFor("eve"), user: "4711"},
+		{name: "no certificate without fallback", user: "4711", password: "secret"},
+		{name: "no certificate with fallback", user: "4711", password: "secret", next: staticAuthenticator{}, id: "4711", ok: true},
+		{name: "no certificate fallback rejects", user: "4711", password: "wrong", next: staticAuthenticator{}, id: "4711"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewClientCertAuthenticator(extractor, mapping, tc.next).(gost.IdentityAuthenticator)
+			ctx := context.Background()
+			if tc.cert != nil {
+				ctx = gost.ContextWithPeerCertificate(ctx, tc.cert)
+			}
+			id, identity, ok := a.AuthenticateIdentity(ctx, tc.user, tc.password)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.id, id)
+			if ok && tc.cert != nil {
+				require.Equal(t, tc.cert.Subject.CommonName, identity.Subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/jwtutil"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// credential is a line of the credentials file: username:hash:agents
+type credential struct {
+	username string
+	hash     string
+	argon2id *argon2idHash
+	agents   []string
+}
+
+// argon2idHash is the parsed argon2id PHC string.
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// dummyPasswordHash is compared for unknown users, the unknown and the known users take the same time.
+const dummyPasswordHash = "$2a$10$rfz77wNnTiBqmvXeGrSDm.wSya.NXjRGeCO0Qi4n2D.dchf3E8ssi"
+
+type ClientFileAuthenticator struct {
+	watcher     *util.FileWatcher
+	credentials atomic.Pointer[map[string]*credential]
+	options     clientAuthenticatorOptions
+	logger      *logger.Logger
+}
+
+// NewClientFileAuthenticator authenticates clients with the htpasswd-style credentials file. Each line contains
+// the username, the bcrypt or argon2id password hash and the comma separated agent IDs or glob patterns:
+//
+//	alice:$2y$10$...:4711,site-eu-*
+//
+// The client sends 'username@agentID' as proxy user, the agent can be omitted when the user has a single agent ID.
+// With the policy authorization the agents are optional, the access to agents is then granted by the policy.
+func NewClientFileAuthenticator(filename string, opts ...ClientAuthenticatorOption) (*ClientFileAuthenticator, error) {
+	a := &ClientFileAuthenticator{
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "file-auth"}),
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	a.watcher = util.NewFileWatcher(filename, a.setCredentials)
+	if err := a.watcher.Load(); err != nil {
+		return nil, fmt.Errorf("credentials file %s: %w", filename, err)
+	}
+	return a, nil
+}
+
+// Watch reloads the credentials file on changes until the context is done.
+func (a *ClientFileAuthenticator) Watch(ctx context.Context, interval time.Duration) {
+	a.watcher.Watch(ctx, interval)
+}
+
+func (a *ClientFileAuthenticator) setCredentials(content []byte) error {
+	credentials, err := parseCredentials(content, a.options.policyAuthorization)
+	if err != nil {
+		return err
+	}
+	a.credentials.Store(&credentials)
+	a.logger.Infof("loaded %d credentials", len(credentials))
+	return nil
+}
+
+// parseCredentials parses the credentials file, the agents can be omitted when they are optional.
+func parseCredentials(content []byte, agentsOptional bool) (map[string]*credential, error) {
+	credentials := make(map[string]*credential)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) == 2 && agentsOptional {
+			parts = append(parts, "")
+		}
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected username:hash:agents", lineNo)
+		}
+		c := &credential{
+			username: parts[0],
+			hash:     parts[1],
+		}
+		if c.username == "" || strings.Contains(c.username, "@") {
+			return nil, fmt.Errorf("line %d: invalid username %q", lineNo, c.username)
+		}
+		switch {
+		case strings.HasPrefix(c.hash, "$argon2id$"):
+			h, err := parseArgon2id(c.hash)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			c.argon2id = h
+		case strings.HasPrefix(c.hash, "$2"):
+			if _, err := bcrypt.Cost([]byte(c.hash)); err != nil {
+				return nil, fmt.Errorf("line %d: bcrypt: %w", lineNo, err)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unsupported password hash, expected bcrypt or argon2id", lineNo)
+		}
+		for _, agent := range strings.Split(parts[2], ",") {
+			if agent = strings.TrimSpace(agent); agent == "" {
+				continue
+			}
+			if _, err := path.Match(agent, ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid agent pattern %s: %w", lineNo, agent, err)
+			}
+			c.agents = append(c.agents, agent)
+		}
+		if len(c.agents) == 0 && !agentsOptional {
+			return nil, fmt.Errorf("line %d: agents are required", lineNo)
+		}
+		if _, ok := credentials[c.username]; ok {
+			return nil, fmt.Errorf("line %d: duplicate username %s", lineNo, c.username)
+		}
+		credentials[c.username] = c
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (a *ClientFileAuthenticator) Authenticate(ctx context.Context, user, password string, opts ...gost.AuthOption) (id string, ok bool) {
+	id, _, ok = a.AuthenticateIdentity(ctx, user, password, opts...)
+	return id, ok
+}
+
+func (a *ClientFileAuthenticator) AuthenticateIdentity(_ context.Context, user, password string, _ ...gost.AuthOption) (id string, identity *gost.ClientIdentity, ok bool) {
+	username, agentID, _ := strings.Cut(user, "@")
+	c, found := (*a.credentials.Load())[username]
+	if !found {
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		a.logger.Warnf("unknown user %s", username)
+		return "", nil, false
+	}
+	if !c.verifyPassword(password) {
+		a.logger.Warnf("invalid password: user %s", username)
+		return "", nil, false
+	}
+	if len(c.agents) == 0 {
+		if !a.options.policyAuthorization {
+			a.logger.Warnf("agents are missing: user %s", username)
+			return "", nil, false
+		}
+	} else {
+		if agentID == "" && len(c.agents) == 1 && !strings.ContainsAny(c.agents[0], `*?[\`) {
+			agentID = c.agents[0]
+		}
+		if !jwtutil.MatchAgentPatterns(c.agents, agentID) {
+			a.logger.Warnf("agentID mismatch: user %s agent %s vs %v", username, agentID, c.agents)
+			return "", nil, false
+		}
+	}
+	if agentID == "" {
+		return "", nil, false
+	}
+	return agentID, &gost.ClientIdentity{Subject: username}, true
+}
+
+func (c *credential) verifyPassword(password string) bool {
+	if c.argon2id != nil {
+		return c.argon2id.compare(password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.hash), []byte(password)) == nil
+}
+
+// parseArgon2id parses and validates the PHC string e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, errors.New("argon2id: invalid hash format")
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, errors.New("argon2id: unsupported version")
+	}
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism); err != nil {
+		return nil, fmt.Errorf("argon2id: invalid parameters: %w", err)
+	}
+	if parts[3] != fmt.Sprintf("m=%d,t=%d,p=%d", h.memory, h.iterations, h.parallelism) {
+		return nil, errors.New("argon2id: invalid parameters")
+	}
+	if h.iterations < 1 || h.parallelism < 1 || h.memory < 8*uint32(h.parallelism) {
+		return nil, errors.New("argon2id: invalid parameters, expected t >= 1, p >= 1 and m >= 8*p")
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(h.salt) == 0 {
+		return nil, errors.New("argon2id: invalid salt")
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errors.New("argon2id: invalid hash")
+	}
+	return h, nil
+}
+
+func (h *argon2idHash) compare(password string) bool {
+	other := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(h.key, other) == 1
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestClientFileAuthenticator(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("alice-secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	salt := []byte("0123456789abcdef")
+	argon2Hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("bob-secret"), salt, 1, 1024, 1, 32)))
+
+	filename := filepath.Join(t.TempDir(), "credentials")
+	content := fmt.Sprintf("# users\nalice:%s:4711\nbob:%s:site-eu-*,4712\n", bcryptHash, argon2Hash)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+
+	a, err := NewClientFileAuthenticator(filename)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Watch(ctx, 10*time.Millisecond)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		id       string
+		ok       bool
+	}{
+		{name: "bcrypt single agent", user: "alice", password: "alice-secret", id: "4711", ok: true},
+		{name: "bcrypt explicit agent", user: "alice@4711", password: "alice-secret", id: "4711", ok: true},
+		{name: "bcrypt agent not allowed", user: "alice@4712", password: "alice-secret"},
+		{name: "bcrypt wrong password", user: "alice", password: "wrong"},
+		{name: "argon2id agent pattern", user: "bob@site-eu-1", password: "bob-secret", id: "site-eu-1", ok: true},
+		{name: "argon2id agent required", user: "bob", password: "bob-secret"},
+		{name: "argon2id wrong password", user: "bob@4712", password: "alice-secret"},
+		{name: "unknown user", user: "eve@4711", password: "alice-secret"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok := a.Authenticate(context.Background(), tc.user, tc.password)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				require.Equal(t, tc.id, id)
+			}
+		})
+	}
+
+	// reload: alice is removed
+	require.NoError(t, os.WriteFile(filename, []byte(fmt.Sprintf("bob:%s:4712\n", argon2Hash)), 0600))
+	require.Eventually(t, func() bool {
+		_, ok := a.Authenticate(context.Background(), "alice", "alice-secret")
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// invalid file keeps the previous credentials
+	require.NoError(t, os.WriteFile(filename, []byte("invalid"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	id, ok := a.Authenticate(context.Background(), "bob", "bob-secret")
+	require.True(t, ok)
+	require.Equal(t, "4712", id)
+}
+
+func TestClientFileAuthenticatorPolicy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	content := fmt.Sprintf("alice:%s\nbob:%s:4711\n", testBcryptHash, testBcryptHash)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+
+	_, err := NewClientFileAuthenticator(filename)
+	require.ErrorContains(t, err, "expected username:hash:agents")
+
+	a, err := NewClientFileAuthenticator(filename, WithPolicyAuthorization())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		user string
+		id   string
+		ok   bool
+	}{
+		{name: "agent granted by policy", user: "alice@4712", id: "4712", ok: true},
+		{name: "agent required", user: "alice"},
+		{name: "agents of the file", user: "bob", id: "4711", ok: true},
+		{name: "agent not in the file", user: "bob@4712"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id, identity, ok := a.AuthenticateIdentity(context.Background(), tc.user, "x")
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				require.Equal(t, tc.id, id)
+				require.NotNil(t, identity)
+			}
+		})
+	}
+}
+
+// testBcryptHash is the bcrypt hash of the password 'x'.
+const testBcryptHash = "$2a$04$CpLm/bS/arQrh0ZG/zdAY.kckr8PRMWPpY.QyJRK.uIyBMV3vfwzO"
+
+func TestParseCredentialsErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{content: "alice", err: "expected username:hash:agents"},
+		{content: "alice:plain:4711", err: "unsupported password hash"},
+		{content: "alice:" + testBcryptHash + ":", err: "agents are required"},
+		{content: "a@b:" + testBcryptHash + ":4711", err: "invalid username"},
+		{content: "alice:" + testBcryptHash + ":4711\nalice:" + testBcryptHash + ":4712", err: "duplicate username"},
+		{content: "alice:$2y$10$x:4711", err: "line 1: bcrypt:"},
+		{content: "bob:$argon2id$v=19$m=65536,t=0,p=1$c2FsdA$aGFzaA:4711", err: "line 1: argon2id: invalid parameters"},
+		{content: "bob:$argon2id$v=19$m=65536,t=1,p=0$c2FsdA$aGFzaA:4711", err: "argon2id: invalid parameters"},
+		{content: "bob:$argon2id$v=19$m=7,t=1,p=1$c2FsdA$aGFzaA:4711", err: "argon2id: invalid parameters"},
+		{content: "bob:$argon2id$v=19$m=64,t=1,p=256$c2FsdA$aGFzaA:4711", err: "argon2id: invalid parameters"},
+		{content: "bob:$argon2id$v=19$m=65536,t=1$c2FsdA$aGFzaA:4711", err: "argon2id: invalid parameters"},
+		{content: "bob:$argon2id$v=16$m=65536,t=1,p=1$c2FsdA$aGFzaA:4711", err: "argon2id: unsupported version"},
+		{content: "bob:$argon2id$v=19$m=65536,t=1,p=1$$aGFzaA:4711", err: "argon2id: invalid salt"},
+		{content: "bob:$argon2id$v=19$m=65536,t=1,p=1$c2FsdA$!!:4711", err: "argon2id: invalid hash"},
+		{content: "bob:$argon2id$v=19$m=65536,t=1,p=1$c2FsdA:4711", err: "argon2id: invalid hash format"},
+	}
+	for _, tc := range tests {
+		_, err := parseCredentials([]byte(tc.content), false)
+		require.ErrorContains(t, err, tc.err)
+	}
+}
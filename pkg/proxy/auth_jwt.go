@@ -13,31 +13,49 @@ import (
 type ClientJwtAuthenticator struct {
 	tokenVerifier jwtutil.TokenVerifier
 	logger        *logger.Logger
+	options       clientAuthenticatorOptions
 }
 
-func NewClientJwtAuthenticator(tokenVerifier jwtutil.TokenVerifier) gost.Authenticator {
-	return &ClientJwtAuthenticator{
+func NewClientJwtAuthenticator(tokenVerifier jwtutil.TokenVerifier, opts ...ClientAuthenticatorOption) gost.Authenticator {
+	a := &ClientJwtAuthenticator{
 		tokenVerifier: tokenVerifier,
 		logger:        logger.GetInstance(),
 	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	return a
 }
 
 func (a *ClientJwtAuthenticator) Authenticate(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, ok bool) {
+	id, _, ok = a.AuthenticateIdentity(ctx, agentID, password, opts...)
+	return id, ok
+}
+
+func (a *ClientJwtAuthenticator) AuthenticateIdentity(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, identity *gost.ClientIdentity, ok bool) {
 	claims, err := a.tokenVerifier.VerifyToken(password)
 	if err != nil {
 		a.logger.Warn("token verification failure", slog.String("agentID", agentID), slog.String("error", err.Error()))
-		return "", false
+		return "", nil, false
 	}
-	if agentID != claims.AgentID {
-		a.logger.Warnf("agentID mismatch: user %s vs claim %s", agentID, claims.AgentID)
-		return "", false
+	if !claims.HasAgents() {
+		if !a.options.policyAuthorization {
+			a.logger.Warnf("agentID claims are missing: user %s", agentID)
+			return "", nil, false
+		}
+	} else if !claims.MatchAgent(agentID) {
+		a.logger.Warnf("agentID mismatch: user %s vs claims %s %v", agentID, claims.AgentID, claims.AgentIDs)
+		return "", nil, false
 	}
 	if config.RoleClient != claims.Role {
 		a.logger.Warnf("role mismatch: role %s vs claim %s", config.RoleClient, claims.Role)
-		return "", false
+		return "", nil, false
 	}
 	if agentID == "" {
-		return "", false
+		return "", nil, false
 	}
-	return claims.AgentID, true
+	return agentID, &gost.ClientIdentity{
+		Subject: claims.Subject,
+		Groups:  claims.Groups,
+	}, true
 }
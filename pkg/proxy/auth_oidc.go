@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/oidc"
+)
+
+type ClientOIDCAuthenticator struct {
+	verifier *oidc.Verifier
+	logger   *logger.Logger
+	options  clientAuthenticatorOptions
+}
+
+func NewClientOIDCAuthenticator(verifier *oidc.Verifier, opts ...ClientAuthenticatorOption) gost.Authenticator {
+	a := &ClientOIDCAuthenticator{
+		verifier: verifier,
+		logger:   logger.GetInstance(),
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	return a
+}
+
+func (a *ClientOIDCAuthenticator) Authenticate(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, ok bool) {
+	id, _, ok = a.AuthenticateIdentity(ctx, agentID, password, opts...)
+	return id, ok
+}
+
+func (a *ClientOIDCAuthenticator) AuthenticateIdentity(ctx context.Context, agentID, password string, opts ...gost.AuthOption) (id string, identity *gost.ClientIdentity, ok bool) {
+	claims, err := a.verifier.VerifyToken(password)
+	if err != nil {
+		a.logger.Warn("oidc token verification failure", slog.String("agentID", agentID), slog.String("error", err.Error()))
+		return "", nil, false
+	}
+	if agentID == "" {
+		return "", nil, false
+	}
+	if len(claims.AgentIDs) == 0 {
+		if !a.options.policyAuthorization {
+			a.logger.Warnf("agents claim is missing: user %s, subject %s", agentID, claims.Subject)
+			return "", nil, false
+		}
+	} else if !claims.MatchAgent(agentID) {
+		a.logger.Warnf("agentID mismatch: user %s vs claim %v", agentID, claims.AgentIDs)
+		return "", nil, false
+	}
+	return agentID, &gost.ClientIdentity{
+		Subject: claims.Subject,
+		Groups:  claims.Groups,
+	}, true
+}
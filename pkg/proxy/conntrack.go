@@ -3,31 +3,48 @@ package proxy
 import (
 	"fmt"
 	"log/slog"
-	"reflect"
+	"time"
 
+	"github.com/grepplabs/reverse-http/pkg/agent"
 	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/session"
 	"github.com/grepplabs/reverse-http/pkg/store"
-	"github.com/quic-go/quic-go"
 )
 
 type ConnTrack struct {
-	trackedConns *SyncedMap[string, AgentID] // quic.ConnectionID => AgentID
-	agentConns   *SyncedMap[AgentID, quic.Connection]
+	trackedConns *SyncedMap[string, AgentID] // session ID => AgentID
+	agentConns   *SyncedMap[AgentID, session.Session]
+	connAttrs    *SyncedMap[session.Session, *agent.Attributes]
+	drainTimeout time.Duration
 	logger       *logger.Logger
 
 	storeClient      store.Client
 	httpProxyAddress string
 }
 
-func NewConnTrack(storeClient store.Client, httpProxyAddress string) *ConnTrack {
-	return &ConnTrack{
+type ConnTrackOption func(*ConnTrack)
+
+// WithConnTrackDrainTimeout keeps the replaced agent connection open to finish its tunnels.
+func WithConnTrackDrainTimeout(drainTimeout time.Duration) ConnTrackOption {
+	return func(ct *ConnTrack) {
+		ct.drainTimeout = drainTimeout
+	}
+}
+
+func NewConnTrack(storeClient store.Client, httpProxyAddress string, opts ...ConnTrackOption) *ConnTrack {
+	ct := &ConnTrack{
 		trackedConns: NewSyncedMap[string, AgentID](),
-		agentConns:   NewSyncedMap[AgentID, quic.Connection](),
+		agentConns:   NewSyncedMap[AgentID, session.Session](),
+		connAttrs:    NewSyncedMap[session.Session, *agent.Attributes](),
 		logger:       logger.GetInstance().WithFields(map[string]any{"kind": "conntrack"}),
 
 		storeClient:      storeClient,
 		httpProxyAddress: httpProxyAddress,
 	}
+	for _, opt := range opts {
+		opt(ct)
+	}
+	return ct
 }
 
 func (ct *ConnTrack) OnConnStarted(connID string) {
@@ -37,7 +54,7 @@ func (ct *ConnTrack) OnConnStarted(connID string) {
 func (ct *ConnTrack) OnConnClose(connID string) {
 	if oldAgentID, ok := ct.trackedConns.GetAndDelete(connID); ok && oldAgentID != "" {
 		if oldConn, ok2 := ct.agentConns.Get(oldAgentID); ok2 && oldConn != nil {
-			oldConnID := getConnID(oldConn)
+			oldConnID := oldConn.ID()
 			if oldConnID == connID {
 				if ct.agentConns.CompareAndDelete(oldAgentID, oldConn) {
 					ct.logger.Info("removed connection", slog.String("agentID", string(oldAgentID)), slog.String("connID", connID))
@@ -50,31 +67,82 @@ func (ct *ConnTrack) OnConnClose(connID string) {
 	}
 }
 
-func (ct *ConnTrack) PutConn(agentID AgentID, conn quic.Connection) error {
-	connID := getConnID(conn)
+func (ct *ConnTrack) PutConn(agentID AgentID, conn session.Session, attrs *agent.Attributes) error {
+	ct.connAttrs.Set(conn, attrs)
+	go func() {
+		<-conn.Context().Done()
+		ct.connAttrs.Delete(conn)
+	}()
+	connID := conn.ID()
 	if connID != "" {
 		if oldAgentID, ok := ct.trackedConns.Get(connID); ok && oldAgentID == "" {
 			if ct.trackedConns.CompareAndSwap(connID, oldAgentID, agentID) {
-				ct.logger.Info("add agent connection", slog.String("agentID", string(agentID)), slog.String("connID", connID))
+				ct.logger.Info("add agent connection", slog.String("agentID", string(agentID)), slog.String("connID", connID), slog.String("remote", conn.RemoteAddr().String()))
 			}
 		}
 	}
-	if oldConn, ok := ct.agentConns.Swap(agentID, conn); ok && oldConn != nil {
-		ct.logger.Info("closing old connection", slog.String("connID", connID))
-		_ = oldConn.CloseWithError(409, "closing old connection")
+	if oldConn, ok := ct.agentConns.Swap(agentID, conn); ok && oldConn != nil && oldConn != conn {
+		if oldAddr, newAddr := oldConn.RemoteAddr().String(), conn.RemoteAddr().String(); oldAddr != newAddr {
+			ct.logger.Info(fmt.Sprintf("agent address changed from %s to %s", oldAddr, newAddr),
+				slog.String("agentID", string(agentID)), slog.String("connID", connID))
+		}
+		ct.retire(oldConn)
 	}
 	// write "own" http proxy address to the store to be found by LB
 	return ct.storeClient.Set(string(agentID), ct.httpProxyAddress)
 }
 
-func (ct *ConnTrack) GetConn(agentID AgentID) (previous quic.Connection, loaded bool) {
+// retire closes the replaced connection after the drain timeout, the new tunnels use the new connection.
+func (ct *ConnTrack) retire(conn session.Session) {
+	connID := conn.ID()
+	if ct.drainTimeout <= 0 {
+		ct.logger.Info("closing old connection", slog.String("connID", connID))
+		_ = conn.CloseWithError(409, "closing old connection")
+		return
+	}
+	ct.logger.Info("draining old connection", slog.String("connID", connID), slog.String("remote", conn.RemoteAddr().String()))
+	go func() {
+		timer := time.NewTimer(ct.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-conn.Context().Done():
+		case <-timer.C:
+			ct.logger.Info("closing drained connection", slog.String("connID", connID))
+			_ = conn.CloseWithError(409, "closing old connection")
+		}
+	}()
+}
+
+// UpdateAttrs replaces the attributes of the live connection after re-authentication.
+func (ct *ConnTrack) UpdateAttrs(conn session.Session, attrs *agent.Attributes) {
+	if conn.Context().Err() != nil {
+		return
+	}
+	ct.connAttrs.Set(conn, attrs)
+}
+
+func (ct *ConnTrack) GetConn(agentID AgentID) (previous session.Session, loaded bool) {
 	conn, ok := ct.agentConns.Get(agentID)
 	return conn, ok
 }
 
+// CloseConnsIf closes agent connections with attributes matching the predicate.
+func (ct *ConnTrack) CloseConnsIf(code session.ErrorCode, reason string, predicate func(attrs *agent.Attributes) bool) {
+	// the draining connections are included
+	conns, connAttrs := ct.connAttrs.Entries()
+	for i, conn := range conns {
+		attrs := connAttrs[i]
+		if attrs == nil || !predicate(attrs) {
+			continue
+		}
+		ct.logger.Info("closing connection", slog.String("agentID", attrs.AgentID), slog.String("connID", conn.ID()), slog.String("reason", reason))
+		_ = conn.CloseWithError(code, reason)
+	}
+}
+
 func (ct *ConnTrack) Shutdown() {
 	agentIDs, conns := ct.agentConns.Entries()
-	for _, conn := range conns {
+	for _, conn := range append(conns, ct.connAttrs.Keys()...) {
 		_ = conn.CloseWithError(0, "proxy server shutdown")
 	}
 	for _, agentID := range agentIDs {
@@ -84,17 +152,3 @@ func (ct *ConnTrack) Shutdown() {
 		}
 	}
 }
-
-func getConnID(conn quic.Connection) string {
-	if conn == nil {
-		return ""
-	}
-	reflectValue := reflect.Indirect(reflect.ValueOf(conn))
-	if reflectValue.Kind() == reflect.Struct {
-		fieldVal := reflectValue.FieldByName("logID")
-		if fieldVal.IsValid() {
-			return fieldVal.String()
-		}
-	}
-	return ""
-}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/agent"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/grepplabs/reverse-http/pkg/store/none"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	session.Session
+	logID     string
+	remote    net.Addr
+	ctx       context.Context
+	cancel    context.CancelFunc
+	handshake chan struct{}
+}
+
+func newFakeConn(logID string, remote string) *fakeConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	handshake := make(chan struct{})
+	close(handshake)
+	return &fakeConn{logID: logID, remote: net.UDPAddrFromAddrPort(netip.MustParseAddrPort(remote)), ctx: ctx, cancel: cancel, handshake: handshake}
+}
+
+func (c *fakeConn) HandshakeComplete() <-chan struct{} {
+	return c.handshake
+}
+
+func (c *fakeConn) Transport() string {
+	return session.TransportQuic
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *fakeConn) Context() context.Context {
+	return c.ctx
+}
+
+func (c *fakeConn) ID() string {
+	return c.logID
+}
+
+func (c *fakeConn) CloseWithError(session.ErrorCode, string) error {
+	c.cancel()
+	return nil
+}
+
+func (c *fakeConn) closed() bool {
+	return c.ctx.Err() != nil
+}
+
+func TestConnTrackAddressChange(t *testing.T) {
+	ct := NewConnTrack(none.NewClient(), "127.0.0.1:3128", WithConnTrackDrainTimeout(100*time.Millisecond))
+	attrs := &agent.Attributes{AgentID: "4711", TokenID: "jti-1"}
+
+	conn1 := newFakeConn("conn1", "192.0.2.10:50001")
+	ct.OnConnStarted(conn1.logID)
+	require.NoError(t, ct.PutConn("4711", conn1, attrs))
+	current, ok := ct.GetConn("4711")
+	require.True(t, ok)
+	require.Equal(t, "192.0.2.10:50001", current.RemoteAddr().String())
+
+	// the agent reconnects from the new address
+	conn2 := newFakeConn("conn2", "198.51.100.20:40002")
+	ct.OnConnStarted(conn2.logID)
+	require.NoError(t, ct.PutConn("4711", conn2, attrs))
+
+	current, ok = ct.GetConn("4711")
+	require.True(t, ok)
+	require.Equal(t, conn2, current)
+	require.Equal(t, "198.51.100.20:40002", current.RemoteAddr().String())
+
+	// the old connection is drained and its close keeps the entry
+	require.False(t, conn1.closed())
+	require.Eventually(t, conn1.closed, time.Second, 10*time.Millisecond)
+	ct.OnConnClose(conn1.logID)
+	_, ok = ct.GetConn("4711")
+	require.True(t, ok)
+
+	// revocation closes the draining connections
+	conn3 := newFakeConn("conn3", "198.51.100.20:40003")
+	ct.OnConnStarted(conn3.logID)
+	require.NoError(t, ct.PutConn("4711", conn3, attrs))
+	ct.CloseConnsIf(401, "token revoked", func(attrs *agent.Attributes) bool {
+		return attrs.TokenID == "jti-1"
+	})
+	require.True(t, conn2.closed())
+	require.True(t, conn3.closed())
+
+	ct.OnConnClose(conn3.logID)
+	_, ok = ct.GetConn("4711")
+	require.False(t, ok)
+}
+
+func TestConnTrackReplaceWithoutDrain(t *testing.T) {
+	ct := NewConnTrack(none.NewClient(), "127.0.0.1:3128")
+	conn1 := newFakeConn("conn1", "192.0.2.10:50001")
+	require.NoError(t, ct.PutConn("4711", conn1, &agent.Attributes{AgentID: "4711"}))
+	conn2 := newFakeConn("conn2", "192.0.2.10:50001")
+	require.NoError(t, ct.PutConn("4711", conn2, &agent.Attributes{AgentID: "4711"}))
+	require.True(t, conn1.closed())
+
+	current, ok := ct.GetConn("4711")
+	require.True(t, ok)
+	require.Equal(t, conn2, current)
+}
@@ -2,11 +2,13 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/url"
 	"time"
 
 	certconfig "github.com/grepplabs/cert-source/config"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
 	tlsserverconfig "github.com/grepplabs/cert-source/tls/server/config"
 	"github.com/grepplabs/reverse-http/pkg/gost"
 	"github.com/grepplabs/reverse-http/pkg/logger"
@@ -27,21 +29,78 @@ func (cd *AgentDialer) Dial(ctx context.Context, addr string, opts ...gost.Diale
 	return cd.agentDialFunc(ctx, AgentID(agentId))
 }
 
+type HttpProxyServerOption func(*HttpProxyServer)
+
+// WithHttpProxyAuthorizer adds the authorizer, all authorizers must allow the request.
+func WithHttpProxyAuthorizer(authorizer gost.Authorizer) HttpProxyServerOption {
+	return func(p *HttpProxyServer) {
+		p.authorizers = append(p.authorizers, authorizer)
+	}
+}
+
+// WithHttpProxyTLSClientAuth overrides the client certificate policy used when the TLS client CA is configured.
+func WithHttpProxyTLSClientAuth(clientAuth tls.ClientAuthType) HttpProxyServerOption {
+	return func(p *HttpProxyServer) {
+		p.tlsClientAuth = &clientAuth
+	}
+}
+
+func WithHttpProxyAuditor(auditor gost.Auditor) HttpProxyServerOption {
+	return func(p *HttpProxyServer) {
+		p.auditor = auditor
+	}
+}
+
+func WithHttpProxyTunnelLimits(limits gost.TransportLimits) HttpProxyServerOption {
+	return func(p *HttpProxyServer) {
+		p.tunnelLimits = limits
+	}
+}
+
+func WithHttpProxyLimiter(limiter gost.Limiter) HttpProxyServerOption {
+	return func(p *HttpProxyServer) {
+		p.limiter = limiter
+	}
+}
+
 type HttpProxyServer struct {
 	ln                  gost.Listener
 	dialAgentFunc       AgentDialFunc
 	clientAuthenticator gost.Authenticator
 	bypass              *util.Whitelist
 	forwardAuth         bool
+	authorizers         []gost.Authorizer
+	tlsClientAuth       *tls.ClientAuthType
+	auditor             gost.Auditor
+	tunnelLimits        gost.TransportLimits
+	limiter             gost.Limiter
 }
 
-func NewHttpProxyServer(listenAddr string, tlsServerConfig certconfig.TLSServerConfig, dialAgentFunc AgentDialFunc, clientAuthenticator gost.Authenticator, bypass *util.Whitelist, forwardAuth bool) (*HttpProxyServer, error) {
+func NewHttpProxyServer(listenAddr string, tlsServerConfig certconfig.TLSServerConfig, dialAgentFunc AgentDialFunc, clientAuthenticator gost.Authenticator, bypass *util.Whitelist, forwardAuth bool, opts ...HttpProxyServerOption) (*HttpProxyServer, error) {
+	p := &HttpProxyServer{
+		dialAgentFunc:       dialAgentFunc,
+		clientAuthenticator: clientAuthenticator,
+		bypass:              bypass,
+		forwardAuth:         forwardAuth,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
 	listenOpts := []gost.ListenerOption{
 		gost.WithListenerAddr(listenAddr),
 	}
 	if tlsServerConfig.Enable {
 		log := logger.GetInstance().WithFields(map[string]any{"kind": "http-proxy"})
-		tlsConfig, err := tlsserverconfig.GetServerTLSConfig(log.Logger, &tlsServerConfig)
+		var tlsOpts []tlsserver.TLSServerConfigOption
+		if p.tlsClientAuth != nil {
+			clientAuth := *p.tlsClientAuth
+			tlsOpts = append(tlsOpts, func(c *tls.Config) {
+				if c.ClientCAs != nil {
+					c.ClientAuth = clientAuth
+				}
+			})
+		}
+		tlsConfig, err := tlsserverconfig.GetServerTLSConfig(log.Logger, &tlsServerConfig, tlsOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -53,13 +112,8 @@ func NewHttpProxyServer(listenAddr string, tlsServerConfig certconfig.TLSServerC
 	if err != nil {
 		return nil, err
 	}
-	return &HttpProxyServer{
-		ln:                  ln,
-		dialAgentFunc:       dialAgentFunc,
-		clientAuthenticator: clientAuthenticator,
-		bypass:              bypass,
-		forwardAuth:         forwardAuth,
-	}, nil
+	p.ln = ln
+	return p, nil
 }
 
 func (p *HttpProxyServer) Shutdown(_ context.Context) error {
@@ -81,6 +135,18 @@ func (p *HttpProxyServer) ListenAndServe() error {
 	if p.bypass != nil {
 		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerBypass(p.bypass))
 	}
+	if len(p.authorizers) != 0 {
+		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerAuthorizer(gost.ChainAuthorizers(p.authorizers...)))
+	}
+	if p.tunnelLimits != (gost.TransportLimits{}) {
+		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerTransportLimits(p.tunnelLimits))
+	}
+	if p.limiter != nil {
+		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerLimiter(p.limiter))
+	}
+	if p.auditor != nil {
+		httpHandlerOpts = append(httpHandlerOpts, gost.WithHandlerAuditor(p.auditor))
+	}
 	httpHandler := gost.NewHttpHandler(httpHandlerOpts...)
 	service := gost.NewService(p.ln, httpHandler)
 	return service.Serve()
@@ -114,6 +180,14 @@ func NewHttpProxyForwardAuth() *HttpProxyForwardAuth {
 	return &HttpProxyForwardAuth{}
 }
 
+// Auth forwards the Proxy-Authorization of the client. Clients authenticated by the client certificate may omit it,
+// the authenticated agent is then forwarded as the proxy user.
 func (a *HttpProxyForwardAuth) Auth(ctx context.Context) *url.Userinfo {
-	return gost.ProxyAuthorizationFromContext(ctx)
+	if auth := gost.ProxyAuthorizationFromContext(ctx); auth != nil {
+		return auth
+	}
+	if clientID := gost.ClientIDFromContext(ctx); clientID != "" {
+		return url.User(string(clientID))
+	}
+	return nil
 }
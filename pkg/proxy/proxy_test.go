@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpProxyForwardAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want *url.Userinfo
+	}{
+		{name: "unauthenticated", ctx: context.Background()},
+		{
+			name: "proxy authorization",
+			ctx:  gost.ContextWithProxyAuthorization(gost.ContextWithClientID(context.Background(), "4711"), url.UserPassword("4711", "token")),
+			want: url.UserPassword("4711", "token"),
+		},
+		{
+			name: "client certificate without proxy authorization",
+			ctx:  gost.ContextWithClientID(context.Background(), "4711"),
+			want: url.User("4711"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, NewHttpProxyForwardAuth().Auth(tc.ctx))
+		})
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"github.com/grepplabs/reverse-http/config"
 	"github.com/grepplabs/reverse-http/pkg/agent"
 	"github.com/grepplabs/reverse-http/pkg/logger"
-	"github.com/grepplabs/reverse-http/pkg/util"
-	"github.com/quic-go/quic-go"
+	"github.com/grepplabs/reverse-http/pkg/revocation"
+	"github.com/grepplabs/reverse-http/pkg/session"
 )
 
 type AgentID string
@@ -38,7 +38,7 @@ func (qs *QuicServer) Close() {
 	qs.connTrack.Shutdown()
 }
 
-func (qs *QuicServer) listenForAgents(ctx context.Context, ln *quic.Listener) error {
+func (qs *QuicServer) listenForAgents(ctx context.Context, ln session.Listener) error {
 	qs.logger.Info("waiting for agents ...")
 
 	for {
@@ -46,9 +46,14 @@ func (qs *QuicServer) listenForAgents(ctx context.Context, ln *quic.Listener) er
 		if err != nil {
 			return err
 		}
-		go func(conn quic.Connection) {
-			log := qs.logger.With(slog.String("connID", getConnID(conn)))
-			log.Info(fmt.Sprintf("got a connection from: %s ", conn.RemoteAddr().String()))
+		qs.connTrack.OnConnStarted(conn.ID())
+		go func() {
+			<-conn.Context().Done()
+			qs.connTrack.OnConnClose(conn.ID())
+		}()
+		go func(conn session.Session) {
+			log := qs.logger.With(slog.String("connID", conn.ID()), slog.String("remote", conn.RemoteAddr().String()))
+			log.Info(fmt.Sprintf("got a %s connection from: %s ", conn.Transport(), conn.RemoteAddr().String()))
 			attrs, err := qs.agentVerifier.Verify(ctx, conn)
 			if err != nil {
 				log.Error("agent auth failure", slog.String("error", err.Error()))
@@ -61,17 +66,104 @@ func (qs *QuicServer) listenForAgents(ctx context.Context, ln *quic.Listener) er
 				return
 			}
 			agentID := AgentID(attrs.AgentID)
+			// the credentials can arrive in the 0-RTT data, a replayed flight never completes the handshake and
+			// must not replace the agent connection
+			select {
+			case <-conn.HandshakeComplete():
+			case <-conn.Context().Done():
+				log.Warn(fmt.Sprintf("agent %s connection closed before the handshake completed", agentID))
+				return
+			}
 			log.Info(fmt.Sprintf("authenticated agent %s", agentID))
-			err = qs.connTrack.PutConn(agentID, conn)
+			err = qs.connTrack.PutConn(agentID, conn, attrs)
 			if err != nil {
 				log.Error("conn track put failed", slog.String("error", err.Error()))
 				_ = conn.CloseWithError(500, "conn track put failure")
 				return
 			}
+			qs.maintainConn(conn, attrs, log)
 		}(conn)
 	}
 }
 
+// maintainConn accepts refreshed agent credentials and closes the connection when the credentials expire.
+func (qs *QuicServer) maintainConn(conn session.Session, attrs *agent.Attributes, log *logger.Logger) {
+	ctx := conn.Context()
+	updates := make(chan *agent.Attributes)
+	if reverifier, ok := qs.agentVerifier.(agent.Reverifier); ok {
+		go func() {
+			for {
+				newAttrs, err := reverifier.Reverify(ctx, conn)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Warn("agent re-authentication failure", slog.String("error", err.Error()))
+					continue
+				}
+				select {
+				case updates <- newAttrs:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		var expired <-chan time.Time
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		if !attrs.ExpiresAt.IsZero() {
+			timer = time.NewTimer(time.Until(attrs.ExpiresAt))
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+			log.Info("agent token expired", slog.String("agentID", attrs.AgentID))
+			_ = conn.CloseWithError(401, "token expired")
+			return
+		case newAttrs := <-updates:
+			if newAttrs.AgentID != attrs.AgentID {
+				log.Warn("agent id changed on re-authentication", slog.String("agentID", attrs.AgentID), slog.String("newAgentID", newAttrs.AgentID))
+				_ = conn.CloseWithError(403, "agent id changed")
+				return
+			}
+			log.Info("agent re-authenticated", slog.String("agentID", newAttrs.AgentID))
+			qs.connTrack.UpdateAttrs(conn, newAttrs)
+			attrs = newAttrs
+		}
+	}
+}
+
+// watchRevocations disconnects agents authenticated with revoked tokens.
+func (qs *QuicServer) watchRevocations(ctx context.Context, revocationList revocation.List, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			qs.connTrack.CloseConnsIf(401, "token revoked", func(attrs *agent.Attributes) bool {
+				return revocationList.IsRevoked(attrs.TokenID)
+			})
+		}
+	}
+}
+
 func (qs *QuicServer) DialAgent(ctx context.Context, agentID AgentID) (net.Conn, error) {
 	conn, ok := qs.connTrack.GetConn(agentID)
 	if !ok {
@@ -82,13 +174,5 @@ func (qs *QuicServer) DialAgent(ctx context.Context, agentID AgentID) (net.Conn,
 		ctx, cancel = context.WithTimeout(ctx, qs.agentDialTimeout)
 		defer cancel()
 	}
-	stream, err := conn.OpenStreamSync(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return &util.QuicConn{
-		Stream: stream,
-		LAddr:  conn.LocalAddr(),
-		RAddr:  conn.RemoteAddr(),
-	}, err
+	return conn.OpenStreamSync(ctx)
 }
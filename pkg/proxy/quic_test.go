@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/agent"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/session"
+	"github.com/grepplabs/reverse-http/pkg/store/none"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeListener struct {
+	conns chan session.Session
+}
+
+func (l *fakeListener) Accept(ctx context.Context) (session.Session, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *fakeListener) Close() error {
+	return nil
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) Verify(_ context.Context, _ session.Session) (*agent.Attributes, error) {
+	return &agent.Attributes{AgentID: "4711"}, nil
+}
+
+func TestListenForAgentsWaitsForHandshake(t *testing.T) {
+	ct := NewConnTrack(none.NewClient(), "127.0.0.1:3128")
+	qs := &QuicServer{agentVerifier: fakeVerifier{}, connTrack: ct, logger: logger.GetInstance()}
+	ln := &fakeListener{conns: make(chan session.Session)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = qs.listenForAgents(ctx, ln)
+	}()
+
+	conn1 := newFakeConn("conn1", "192.0.2.10:50001")
+	ln.conns <- conn1
+	require.Eventually(t, func() bool {
+		current, ok := ct.GetConn("4711")
+		return ok && current == conn1
+	}, time.Second, 10*time.Millisecond)
+
+	// a replayed 0-RTT flight authenticates the agent, but the handshake never completes
+	replay := newFakeConn("replay", "203.0.113.5:40000")
+	replay.handshake = make(chan struct{})
+	ln.conns <- replay
+	time.Sleep(100 * time.Millisecond)
+	current, ok := ct.GetConn("4711")
+	require.True(t, ok)
+	require.Equal(t, conn1, current)
+	require.False(t, conn1.closed())
+
+	// the handshake times out
+	_ = replay.CloseWithError(0, "handshake timeout")
+	time.Sleep(50 * time.Millisecond)
+	current, _ = ct.GetConn("4711")
+	require.Equal(t, conn1, current)
+	require.False(t, conn1.closed())
+
+	// a completed handshake replaces the connection
+	conn2 := newFakeConn("conn2", "192.0.2.10:50002")
+	ln.conns <- conn2
+	require.Eventually(t, func() bool {
+		current, ok := ct.GetConn("4711")
+		return ok && current == conn2
+	}, time.Second, 10*time.Millisecond)
+}
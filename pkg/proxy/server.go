@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -17,13 +18,20 @@ import (
 	tlsserverconfig "github.com/grepplabs/cert-source/tls/server/config"
 	"github.com/grepplabs/reverse-http/config"
 	"github.com/grepplabs/reverse-http/pkg/agent"
+	"github.com/grepplabs/reverse-http/pkg/audit"
 	"github.com/grepplabs/reverse-http/pkg/gost"
 	"github.com/grepplabs/reverse-http/pkg/jwtutil"
+	"github.com/grepplabs/reverse-http/pkg/limit"
 	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/oidc"
+	"github.com/grepplabs/reverse-http/pkg/policy"
+	"github.com/grepplabs/reverse-http/pkg/revocation"
+	"github.com/grepplabs/reverse-http/pkg/session"
 	"github.com/grepplabs/reverse-http/pkg/store"
 	storememcached "github.com/grepplabs/reverse-http/pkg/store/memcached"
 	storenone "github.com/grepplabs/reverse-http/pkg/store/none"
 	"github.com/grepplabs/reverse-http/pkg/util"
+	"github.com/grepplabs/reverse-http/pkg/webhook"
 	"github.com/oklog/run"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
@@ -34,8 +42,9 @@ func RunProxyServer(conf *config.ProxyCmd) {
 	group := new(run.Group)
 
 	util.AddQuitSignal(group)
-	dialAgentFunc := addQuicServer(conf, group)
-	addProxyHttpServer(conf, group, dialAgentFunc)
+	revocationList := addRevocationList(&conf.Auth, conf.Store.Type, conf.Store.Memcached, group)
+	dialAgentFunc := addQuicServer(conf, group, revocationList)
+	addProxyHttpServer(conf, group, dialAgentFunc, revocationList)
 
 	err := group.Run()
 	if err != nil {
@@ -50,7 +59,8 @@ func RunLoadBalancerServer(conf *config.LoadBalancerCmd) {
 	group := new(run.Group)
 
 	util.AddQuitSignal(group)
-	addLoadBalancerServer(conf, group)
+	revocationList := addRevocationList(&conf.Auth, conf.Store.Type, conf.Store.Memcached, group)
+	addLoadBalancerServer(conf, group, revocationList)
 
 	err := group.Run()
 	if err != nil {
@@ -64,34 +74,83 @@ func Tracer(connTrack *ConnTrack) func(_ context.Context, perspective logging.Pe
 	return func(_ context.Context, perspective logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
 		ct := logging.ConnectionTracer{
 			StartedConnection: func(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
-				connTrack.logger.Info("connection start", slog.String("connID", connID.String()))
-				if perspective == logging.PerspectiveServer && connID.Len() != 0 {
-					connTrack.OnConnStarted(connID.String())
-				}
+				connTrack.logger.Info("connection start", slog.String("connID", connID.String()), slog.String("remote", remote.String()))
 			},
 			Close: func() {
 				connTrack.logger.Info("connection close", slog.String("connID", connID.String()))
-				if perspective == logging.PerspectiveServer && connID.Len() != 0 {
-					connTrack.OnConnClose(connID.String())
-				}
 			},
 		}
 		return logging.NewMultiplexedConnectionTracer(&ct)
 	}
 }
 
-func addQuicServer(conf *config.ProxyCmd, group *run.Group) AgentDialFunc {
+func addRevocationList(conf *config.AuthVerifier, storeType string, memcachedConfig config.MemcachedConfig, group *run.Group) revocation.List {
+	log := logger.GetInstance().WithFields(map[string]any{"kind": "revocation"})
+	switch conf.Revocation.Type {
+	case config.RevocationNone:
+		return nil
+	case config.RevocationFile:
+		fileList, err := revocation.NewFileList(conf.Revocation.File)
+		if err != nil {
+			log.Error("error while revocation file setup", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		group.Add(func() error {
+			fileList.Watch(ctx, conf.Revocation.Refresh)
+			<-ctx.Done()
+			return nil
+		}, func(error) {
+			cancel()
+		})
+		return fileList
+	case config.RevocationStore:
+		if storeType != config.StoreMemcached {
+			log.Error(fmt.Sprintf("revocation store requires store type %s", config.StoreMemcached))
+			os.Exit(1)
+		}
+		storeClient := storememcached.NewClient(memcachedConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+		group.Add(func() error {
+			<-ctx.Done()
+			return nil
+		}, func(error) {
+			cancel()
+			storeClient.Close()
+		})
+		return revocation.NewStoreList(storeClient)
+	default:
+		log.Error(fmt.Sprintf("unsupported revocation type: %s", conf.Revocation.Type))
+		os.Exit(1)
+		return nil
+	}
+}
+
+func addQuicServer(conf *config.ProxyCmd, group *run.Group, revocationList revocation.List) AgentDialFunc {
 	log := logger.GetInstance().WithFields(map[string]any{"kind": "quic-server"})
+	tlsOpts := []tlsserver.TLSServerConfigOption{tlsserver.WithTLSServerNextProtos([]string{config.ReverseHttpProto})}
+	sessionTickets, err := getSessionTickets(conf, revocationList)
+	if err != nil {
+		log.Error("error while session ticket setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if sessionTickets != nil {
+		tlsOpts = append(tlsOpts, withTLSSessionTicketKey(sessionTickets.TLSSessionTicketKey()))
+	}
 	tlsConfig, err := tlsserverconfig.GetServerTLSConfig(log.Logger, &tlsconfig.TLSServerConfig{
 		Enable:  true,
 		Refresh: conf.AgentServer.TLS.Refresh,
 		File:    conf.AgentServer.TLS.File,
-	}, tlsserver.WithTLSServerNextProtos([]string{config.ReverseHttpProto}))
+	}, tlsOpts...)
 	if err != nil {
 		log.Error("error while during server tls config setup", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
-	agentVerifier, err := getAgentVerifier(&conf.Auth)
+	if conf.Auth.GetAgentType() == config.AuthMTLS && conf.AgentServer.TLS.File.ClientCAs == "" {
+		log.Error("mtls agent verifier requires the agent server client CA")
+		os.Exit(1)
+	}
+	agentVerifier, err := getAgentVerifier(&conf.Auth, revocationList, sessionTickets)
 	if err != nil {
 		log.Error("error while agent verifier setup", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -106,13 +165,12 @@ func addQuicServer(conf *config.ProxyCmd, group *run.Group) AgentDialFunc {
 		httpProxyAddress = conf.HttpProxyServer.ListenAddress
 	}
 	log.Info(fmt.Sprintf("store http proxy address %s", httpProxyAddress))
-	connTrack := NewConnTrack(storeClient, httpProxyAddress)
+	connTrack := NewConnTrack(storeClient, httpProxyAddress, WithConnTrackDrainTimeout(conf.AgentServer.Agent.DrainTimeout))
 	listenAddr := conf.AgentServer.ListenAddress
 	log.Info(fmt.Sprintf("starting UDP agent server on %s", listenAddr))
-	ln, err := quic.ListenAddr(listenAddr, tlsConfig, &quic.Config{
-		KeepAlivePeriod: config.DefaultKeepAlivePeriod,
-		Tracer:          Tracer(connTrack),
-	})
+	quicConfig := util.NewQuicConfig(conf.AgentServer.Quic)
+	quicConfig.Tracer = Tracer(connTrack)
+	ln, err := session.ListenQuic(listenAddr, tlsConfig, quicConfig)
 	if err != nil {
 		log.Error("error while starting agent server", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -126,6 +184,48 @@ func addQuicServer(conf *config.ProxyCmd, group *run.Group) AgentDialFunc {
 		storeClient.Close()
 		_ = ln.Close()
 	})
+	if tcpListenAddr := conf.AgentServer.TCPListenAddress; tcpListenAddr != "" {
+		log.Info(fmt.Sprintf("starting TCP agent server on %s", tcpListenAddr))
+		tcpLn, err := session.ListenTCP(tcpListenAddr, tlsConfig, session.MuxConfig{
+			KeepAlivePeriod:  conf.AgentServer.Quic.KeepAlivePeriod,
+			HandshakeTimeout: conf.AgentServer.Quic.HandshakeIdleTimeout,
+		})
+		if err != nil {
+			log.Error("error while starting TCP agent server", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		group.Add(func() error {
+			return quicServer.listenForAgents(context.Background(), tcpLn)
+		}, func(error) {
+			_ = tcpLn.Close()
+		})
+	}
+	if wsListenAddr := conf.AgentServer.WebSocket.ListenAddress; wsListenAddr != "" {
+		log.Info(fmt.Sprintf("starting WebSocket agent server on %s", wsListenAddr))
+		wsLn, err := session.ListenWebSocket(wsListenAddr, conf.AgentServer.WebSocket.Path, tlsConfig, session.MuxConfig{
+			KeepAlivePeriod:  conf.AgentServer.Quic.KeepAlivePeriod,
+			HandshakeTimeout: conf.AgentServer.Quic.HandshakeIdleTimeout,
+		})
+		if err != nil {
+			log.Error("error while starting WebSocket agent server", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		group.Add(func() error {
+			return quicServer.listenForAgents(context.Background(), wsLn)
+		}, func(error) {
+			_ = wsLn.Close()
+		})
+	}
+	if revocationList != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		group.Add(func() error {
+			quicServer.watchRevocations(ctx, revocationList, conf.Auth.Revocation.Refresh)
+			<-ctx.Done()
+			return nil
+		}, func(error) {
+			cancel()
+		})
+	}
 	return quicServer.DialAgent
 }
 
@@ -141,48 +241,260 @@ func getProxyStoreClient(conf *config.ProxyCmd, log *logger.Logger) (store.Clien
 	}
 }
 
-func getAgentVerifier(conf *config.AuthVerifier) (agent.Verifier, error) {
-	switch conf.Type {
+func getSessionTickets(conf *config.ProxyCmd, revocationList revocation.List) (*agent.SessionTickets, error) {
+	if conf.AgentServer.SessionTicket.Secret == "" {
+		return nil, nil
+	}
+	secret, err := agent.LoadSessionTicketSecret(conf.AgentServer.SessionTicket.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var opts []agent.SessionTicketsOption
+	if revocationList != nil {
+		opts = append(opts, agent.WithSessionTicketsRevocationList(revocationList))
+	}
+	return agent.NewSessionTickets(secret, conf.AgentServer.SessionTicket.TTL, opts...)
+}
+
+// withTLSSessionTicketKey sets the same TLS session ticket key on all proxies and across restarts.
+func withTLSSessionTicketKey(key [32]byte) tlsserver.TLSServerConfigOption {
+	return func(c *tls.Config) {
+		c.SetSessionTicketKeys([][32]byte{key})
+	}
+}
+
+func getAgentVerifier(conf *config.AuthVerifier, revocationList revocation.List, sessionTickets *agent.SessionTickets) (agent.Verifier, error) {
+	switch conf.GetAgentType() {
 	case config.AuthNoAuth:
 		return agent.NewNoAuthVerifier(), nil
 	case config.AuthJWT:
-		publicKey, err := keyutil.ReadPublicKeyFile(conf.JWTVerifier.PublicKey)
+		tokenVerifier, err := getTokenVerifier(conf, revocationList)
+		if err != nil {
+			return nil, err
+		}
+		return agent.NewJWTVerifier(tokenVerifier, agent.WithJWTVerifierSessionTickets(sessionTickets)), nil
+	case config.AuthMTLS:
+		extractor, err := util.NewCertIdentityExtractor(conf.MTLSVerifier.AgentIDSource, conf.MTLSVerifier.URIPrefix, conf.MTLSVerifier.OID)
 		if err != nil {
 			return nil, err
 		}
-		tokenVerifier := jwtutil.NewTokenVerifier(publicKey, jwtutil.WithVerifierAudience(conf.JWTVerifier.Audience))
-		return agent.NewJWTVerifier(tokenVerifier), nil
+		return agent.NewMTLSVerifier(extractor), nil
 	default:
-		return nil, fmt.Errorf("unsupported agent verifier type: %s", conf.Type)
+		return nil, fmt.Errorf("unsupported agent verifier type: %s", conf.GetAgentType())
 	}
 }
 
-func getClientVerifier(conf *config.AuthVerifier) (gost.Authenticator, error) {
-	switch conf.Type {
+func getClientVerifier(conf *config.AuthVerifier, revocationList revocation.List, group *run.Group) (gost.Authenticator, error) {
+	var opts []ClientAuthenticatorOption
+	if conf.PolicyFile != "" {
+		opts = append(opts, WithPolicyAuthorization())
+	}
+	switch conf.GetClientType() {
 	case config.AuthNoAuth:
 		return NewClientNoAuthAuthenticator(), nil
 	case config.AuthJWT:
-		publicKey, err := keyutil.ReadPublicKeyFile(conf.JWTVerifier.PublicKey)
+		tokenVerifier, err := getTokenVerifier(conf, revocationList)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientJwtAuthenticator(tokenVerifier, opts...), nil
+	case config.AuthOIDC:
+		oidcOpts := []oidc.VerifierOption{
+			oidc.WithAudience(conf.OIDCVerifier.Audience),
+			oidc.WithAgentsClaim(conf.OIDCVerifier.AgentsClaim),
+			oidc.WithGroupsClaim(conf.OIDCVerifier.GroupsClaim),
+			oidc.WithJWKSRefresh(conf.OIDCVerifier.JWKSRefresh),
+		}
+		if revocationList != nil {
+			oidcOpts = append(oidcOpts, oidc.WithRevocationList(revocationList))
+		}
+		oidcVerifier, err := oidc.NewVerifier(context.Background(), conf.OIDCVerifier.Issuer, oidcOpts...)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientOIDCAuthenticator(oidcVerifier, opts...), nil
+	case config.AuthFile:
+		fileAuthenticator, err := NewClientFileAuthenticator(conf.FileVerifier.Credentials, opts...)
 		if err != nil {
 			return nil, err
 		}
-		tokenVerifier := jwtutil.NewTokenVerifier(publicKey, jwtutil.WithVerifierAudience(conf.JWTVerifier.Audience))
-		return NewClientJwtAuthenticator(tokenVerifier), nil
+		ctx, cancel := context.WithCancel(context.Background())
+		group.Add(func() error {
+			fileAuthenticator.Watch(ctx, conf.FileVerifier.Refresh)
+			<-ctx.Done()
+			return nil
+		}, func(error) {
+			cancel()
+		})
+		return fileAuthenticator, nil
 	default:
-		return nil, fmt.Errorf("unsupported client verifier type: %s", conf.Type)
+		return nil, fmt.Errorf("unsupported client verifier type: %s", conf.GetClientType())
+	}
+}
+
+// addClientCertAuthenticator wraps the client verifier with the client certificate authentication when the mapping is set.
+func addClientCertAuthenticator(conf *config.ClientCertAuth, tlsConf *tlsconfig.TLSServerConfig, authConf *config.AuthVerifier, clientVerifier gost.Authenticator, serverOpts []HttpProxyServerOption, log *logger.Logger) (gost.Authenticator, []HttpProxyServerOption) {
+	if conf.Mapping == "" {
+		return clientVerifier, serverOpts
+	}
+	if !tlsConf.Enable || tlsConf.File.ClientCAs == "" {
+		log.Error("client certificate authentication requires the http proxy TLS client CA")
+		os.Exit(1)
 	}
+	clientVerifier, err := getClientCertAuthenticator(conf, authConf, clientVerifier)
+	if err != nil {
+		log.Error("error while client certificate authenticator setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if !conf.Required {
+		serverOpts = append(serverOpts, WithHttpProxyTLSClientAuth(tls.VerifyClientCertIfGiven))
+	}
+	return clientVerifier, serverOpts
 }
 
-func addProxyHttpServer(conf *config.ProxyCmd, group *run.Group, dialAgentFunc AgentDialFunc) {
+func getClientCertAuthenticator(conf *config.ClientCertAuth, authConf *config.AuthVerifier, next gost.Authenticator) (gost.Authenticator, error) {
+	extractor, err := util.NewCertIdentityExtractor(conf.IdentitySource, conf.URIPrefix, conf.OID)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := LoadClientCertMapping(conf.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	var opts []ClientAuthenticatorOption
+	if authConf.PolicyFile != "" {
+		opts = append(opts, WithPolicyAuthorization())
+	}
+	if conf.Required {
+		next = nil
+	}
+	return NewClientCertAuthenticator(extractor, mapping, next, opts...), nil
+}
+
+func getTokenVerifier(conf *config.AuthVerifier, revocationList revocation.List) (jwtutil.TokenVerifier, error) {
+	verifierOpts := []jwtutil.TokenVerifierOption{
+		jwtutil.WithVerifierAudience(conf.JWTVerifier.Audience),
+	}
+	if revocationList != nil {
+		verifierOpts = append(verifierOpts, jwtutil.WithVerifierRevocationList(revocationList))
+	}
+	if conf.JWTVerifier.JWKS != "" {
+		keySet, err := jwtutil.NewJWKSKeySet(conf.JWTVerifier.JWKS, jwtutil.WithJWKSRefresh(conf.JWTVerifier.JWKSRefresh))
+		if err != nil {
+			return nil, err
+		}
+		return jwtutil.NewKeySetTokenVerifier(keySet, verifierOpts...), nil
+	}
+	publicKey, err := keyutil.ReadPublicKeyFile(conf.JWTVerifier.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return jwtutil.NewTokenVerifier(publicKey, verifierOpts...), nil
+}
+
+func addAuditor(auditLog string, group *run.Group, log *logger.Logger) []HttpProxyServerOption {
+	if auditLog == "" {
+		return nil
+	}
+	auditor, err := audit.NewFileLogger(auditLog)
+	if err != nil {
+		log.Error("error while audit log setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	group.Add(func() error {
+		<-ctx.Done()
+		return nil
+	}, func(error) {
+		cancel()
+		_ = auditor.Close()
+	})
+	return []HttpProxyServerOption{WithHttpProxyAuditor(auditor)}
+}
+
+// addHostWhitelist returns the whitelist of the patterns, the whitelist file rules follow the patterns and are reloaded on changes.
+func addHostWhitelist(patterns []string, fileConf config.HostWhitelistFile, group *run.Group, log *logger.Logger) *util.Whitelist {
+	if fileConf.File == "" {
+		return util.WhitelistFromStrings(patterns)
+	}
+	whitelistFile, err := util.NewWhitelistFile(fileConf.File, patterns)
+	if err != nil {
+		log.Error("error while whitelist file setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	group.Add(func() error {
+		whitelistFile.Watch(ctx, fileConf.Refresh)
+		<-ctx.Done()
+		return nil
+	}, func(error) {
+		cancel()
+	})
+	return whitelistFile.Whitelist()
+}
+
+func getHttpProxyServerOptions(conf *config.AuthVerifier) ([]HttpProxyServerOption, error) {
+	var opts []HttpProxyServerOption
+	if conf.PolicyFile != "" {
+		p, err := policy.LoadFile(conf.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithHttpProxyAuthorizer(p))
+	}
+	if conf.AuthzWebhook.URL != "" {
+		authorizer, err := webhook.NewAuthorizer(conf.AuthzWebhook.URL,
+			webhook.WithTimeout(conf.AuthzWebhook.Timeout),
+			webhook.WithFailOpen(conf.AuthzWebhook.FailOpen),
+			webhook.WithCacheTTL(conf.AuthzWebhook.CacheTTL),
+		)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithHttpProxyAuthorizer(authorizer))
+	}
+	return opts, nil
+}
+
+// getTunnelLimitOptions returns the tunnel limits, the limiter is added when a rate or concurrency limit is set.
+func getTunnelLimitOptions(tunnel config.TunnelLimits, limits config.TunnelRateLimits) []HttpProxyServerOption {
+	opts := []HttpProxyServerOption{WithHttpProxyTunnelLimits(gost.TransportLimits{
+		IdleTimeout: tunnel.IdleTimeout,
+		MaxDuration: tunnel.MaxDuration,
+		MaxBytes:    tunnel.MaxBytes,
+	})}
+	limitConfig := limit.Config{
+		MaxTunnelsPerAgent:  limits.MaxTunnelsPerAgent,
+		MaxTunnelsPerClient: limits.MaxTunnelsPerClient,
+		TunnelRate:          limits.TunnelRate,
+		TunnelBurst:         limits.TunnelBurst,
+		AgentBandwidth:      limits.AgentBandwidth,
+	}
+	if limitConfig.Enabled() {
+		opts = append(opts, WithHttpProxyLimiter(limit.NewLimiter(limitConfig)))
+	}
+	return opts
+}
+
+func addProxyHttpServer(conf *config.ProxyCmd, group *run.Group, dialAgentFunc AgentDialFunc, revocationList revocation.List) {
 	log := logger.GetInstance().WithFields(map[string]any{"kind": "http-proxy"})
-	clientVerifier, err := getClientVerifier(&conf.Auth)
+	clientVerifier, err := getClientVerifier(&conf.Auth, revocationList, group)
 	if err != nil {
 		log.Error("error while client verifier setup", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
+	serverOpts, err := getHttpProxyServerOptions(&conf.Auth)
+	if err != nil {
+		log.Error("error while http proxy server options setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	serverOpts = append(serverOpts, addAuditor(conf.HttpProxyServer.AuditLog, group, log)...)
+	serverOpts = append(serverOpts, getTunnelLimitOptions(conf.HttpProxyServer.Tunnel, conf.HttpProxyServer.Limits)...)
+	clientVerifier, serverOpts = addClientCertAuthenticator(&conf.HttpProxyServer.ClientCert, &conf.HttpProxyServer.TLS, &conf.Auth, clientVerifier, serverOpts, log)
+	hostWhitelist := addHostWhitelist(conf.HttpProxyServer.HostWhitelist, conf.HttpProxyServer.HostWhitelistFile, group, log)
 	const forwardAuth = false
 	listenAddr := conf.HttpProxyServer.ListenAddress
-	srv, err := NewHttpProxyServer(listenAddr, conf.HttpProxyServer.TLS, dialAgentFunc, clientVerifier, util.WhitelistFromStrings(conf.HttpProxyServer.HostWhitelist), forwardAuth)
+	srv, err := NewHttpProxyServer(listenAddr, conf.HttpProxyServer.TLS, dialAgentFunc, clientVerifier, hostWhitelist, forwardAuth, serverOpts...)
 	if err != nil {
 		log.Error("error while starting http proxy server", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -203,9 +515,9 @@ func addProxyHttpServer(conf *config.ProxyCmd, group *run.Group, dialAgentFunc A
 	})
 }
 
-func addLoadBalancerServer(conf *config.LoadBalancerCmd, group *run.Group) {
+func addLoadBalancerServer(conf *config.LoadBalancerCmd, group *run.Group, revocationList revocation.List) {
 	log := logger.GetInstance().WithFields(map[string]any{"kind": "lb-server"})
-	clientVerifier, err := getClientVerifier(&conf.Auth)
+	clientVerifier, err := getClientVerifier(&conf.Auth, revocationList, group)
 	if err != nil {
 		log.Error("error while client verifier setup", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -221,10 +533,19 @@ func addLoadBalancerServer(conf *config.LoadBalancerCmd, group *run.Group) {
 		log.Error("error while connector tls setup", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
+	serverOpts, err := getHttpProxyServerOptions(&conf.Auth)
+	if err != nil {
+		log.Error("error while lb proxy server options setup", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	serverOpts = append(serverOpts, addAuditor(conf.HttpProxyServer.AuditLog, group, log)...)
+	serverOpts = append(serverOpts, getTunnelLimitOptions(conf.HttpProxyServer.Tunnel, conf.HttpProxyServer.Limits)...)
+	clientVerifier, serverOpts = addClientCertAuthenticator(&conf.HttpProxyServer.ClientCert, &conf.HttpProxyServer.TLS, &conf.Auth, clientVerifier, serverOpts, log)
+	hostWhitelist := addHostWhitelist(conf.HttpProxyServer.HostWhitelist, conf.HttpProxyServer.HostWhitelistFile, group, log)
 	const forwardAuth = true
 	dialAgentFunc := NewLoadBalancerDialer(storeClient, tlsConfigFunc)
 	listenAddr := conf.HttpProxyServer.ListenAddress
-	srv, err := NewHttpProxyServer(listenAddr, conf.HttpProxyServer.TLS, dialAgentFunc.Dial, clientVerifier, util.WhitelistFromStrings(conf.HttpProxyServer.HostWhitelist), forwardAuth)
+	srv, err := NewHttpProxyServer(listenAddr, conf.HttpProxyServer.TLS, dialAgentFunc.Dial, clientVerifier, hostWhitelist, forwardAuth, serverOpts...)
 	if err != nil {
 		log.Error("error while starting lb proxy server", slog.String("error", err.Error()))
 		os.Exit(1)
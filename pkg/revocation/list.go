@@ -0,0 +1,96 @@
+package revocation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/grepplabs/reverse-http/pkg/store"
+	"github.com/grepplabs/reverse-http/pkg/util"
+)
+
+const StoreKeyPrefix = "revoked-"
+
+// List contains the IDs (jti) of revoked tokens.
+type List interface {
+	IsRevoked(tokenID string) bool
+}
+
+// FileList reads revoked token IDs from a file, one per line. Empty lines and lines starting with '#' are ignored.
+type FileList struct {
+	ids     atomic.Pointer[map[string]struct{}]
+	watcher *util.FileWatcher
+	logger  *logger.Logger
+}
+
+func NewFileList(filename string) (*FileList, error) {
+	l := &FileList{
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "revocation-file"}),
+	}
+	l.watcher = util.NewFileWatcher(filename, l.update)
+	if err := l.watcher.Load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *FileList) update(content []byte) error {
+	ids := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.ids.Store(&ids)
+	l.logger.Infof("loaded %d revoked token ids", len(ids))
+	return nil
+}
+
+func (l *FileList) IsRevoked(tokenID string) bool {
+	if tokenID == "" {
+		return false
+	}
+	_, ok := (*l.ids.Load())[tokenID]
+	return ok
+}
+
+// Watch reloads the file on changes until the context is done.
+func (l *FileList) Watch(ctx context.Context, interval time.Duration) {
+	l.watcher.Watch(ctx, interval)
+}
+
+// StoreList checks if the store contains the key StoreKeyPrefix + tokenID.
+type StoreList struct {
+	client store.Client
+	logger *logger.Logger
+}
+
+func NewStoreList(client store.Client) *StoreList {
+	return &StoreList{
+		client: client,
+		logger: logger.GetInstance().WithFields(map[string]any{"kind": "revocation-store"}),
+	}
+}
+
+func (l *StoreList) IsRevoked(tokenID string) bool {
+	if tokenID == "" {
+		return false
+	}
+	value, err := l.client.Get(StoreKeyPrefix + tokenID)
+	if err != nil {
+		// the store is not available, tokens cannot be checked
+		l.logger.Warnf("revocation check of %s failed: %v", tokenID, err)
+		return false
+	}
+	return value != ""
+}
@@ -0,0 +1,40 @@
+package revocation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileList(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "revoked.txt")
+	require.NoError(t, os.WriteFile(filename, []byte("# leaked tokens\n\n  id-1  \nid-2\n"), 0600))
+
+	list, err := NewFileList(filename)
+	require.NoError(t, err)
+	require.True(t, list.IsRevoked("id-1"))
+	require.True(t, list.IsRevoked("id-2"))
+	require.False(t, list.IsRevoked("id-3"))
+	require.False(t, list.IsRevoked(""))
+	require.False(t, list.IsRevoked("# leaked tokens"))
+
+	require.NoError(t, os.WriteFile(filename, []byte("id-3\n"), 0600))
+	require.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Second)))
+	changed, err := list.watcher.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.False(t, list.IsRevoked("id-1"))
+	require.True(t, list.IsRevoked("id-3"))
+
+	changed, err = list.watcher.Reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+}
+
+func TestFileListMissing(t *testing.T) {
+	_, err := NewFileList(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,275 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"github.com/hashicorp/yamux"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// MuxConfig configures the sessions multiplexed over TCP connections.
+type MuxConfig struct {
+	// KeepAlivePeriod is the interval of the pings, zero disables the keep-alive.
+	KeepAlivePeriod time.Duration
+	// HandshakeTimeout is the timeout of the TLS handshake.
+	HandshakeTimeout time.Duration
+}
+
+func (c MuxConfig) yamuxConfig() *yamux.Config {
+	conf := yamux.DefaultConfig()
+	conf.LogOutput = nil
+	conf.Logger = slog.NewLogLogger(logger.GetInstance().WithFields(map[string]any{"kind": "mux"}).Handler(), slog.LevelDebug)
+	if c.KeepAlivePeriod > 0 {
+		conf.KeepAliveInterval = c.KeepAlivePeriod
+	} else {
+		conf.EnableKeepAlive = false
+	}
+	return conf
+}
+
+func (c MuxConfig) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout > 0 {
+		return c.HandshakeTimeout
+	}
+	return defaultHandshakeTimeout
+}
+
+type muxSession struct {
+	mux       *yamux.Session
+	state     tls.ConnectionState
+	ctx       context.Context
+	id        string
+	transport string
+}
+
+// muxStream is the yamux stream, the yamux close is a half-close.
+type muxStream struct {
+	*yamux.Stream
+}
+
+func (s *muxStream) CloseWrite() error {
+	return s.Stream.Close()
+}
+
+// NewMuxClient creates the agent side of the session multiplexed over the connection.
+func NewMuxClient(conn net.Conn, conf MuxConfig) (Session, error) {
+	return newMuxClient(conn, conf, TransportTCP)
+}
+
+// NewMuxServer creates the proxy side of the session multiplexed over the connection.
+func NewMuxServer(conn net.Conn, conf MuxConfig) (Session, error) {
+	return newMuxServer(conn, conf, TransportTCP)
+}
+
+// DialTCP connects the session multiplexed over a TLS connection, the TLS handshake is bounded by the handshake timeout.
+func DialTCP(ctx context.Context, addr string, tlsConfig *tls.Config, conf MuxConfig) (Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, conf.handshakeTimeout())
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := NewMuxClient(conn, conf)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+func newMuxClient(conn net.Conn, conf MuxConfig, transport string) (Session, error) {
+	mux, err := yamux.Client(conn, conf.yamuxConfig())
+	if err != nil {
+		return nil, err
+	}
+	return newMuxSession(conn, mux, transport), nil
+}
+
+func newMuxServer(conn net.Conn, conf MuxConfig, transport string) (Session, error) {
+	mux, err := yamux.Server(conn, conf.yamuxConfig())
+	if err != nil {
+		return nil, err
+	}
+	return newMuxSession(conn, mux, transport), nil
+}
+
+func newMuxSession(conn net.Conn, mux *yamux.Session, transport string) *muxSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-mux.CloseChan()
+		cancel()
+	}()
+	s := &muxSession{
+		mux:       mux,
+		ctx:       ctx,
+		id:        newSessionID(transport),
+		transport: transport,
+	}
+	if tlsConn, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		s.state = tlsConn.ConnectionState()
+	}
+	return s
+}
+
+func newSessionID(transport string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return transport + "-" + hex.EncodeToString(b)
+}
+
+func (s *muxSession) OpenStreamSync(ctx context.Context) (Stream, error) {
+	type result struct {
+		stream *yamux.Stream
+		err    error
+	}
+	// yamux opens the streams without context
+	results := make(chan result, 1)
+	go func() {
+		stream, err := s.mux.OpenStream()
+		results <- result{stream: stream, err: err}
+	}()
+	select {
+	case r := <-results:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &muxStream{Stream: r.stream}, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-results; r.stream != nil {
+				_ = r.stream.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *muxSession) AcceptStream(ctx context.Context) (Stream, error) {
+	stream, err := s.mux.AcceptStreamWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &muxStream{Stream: stream}, nil
+}
+
+// CloseWithError closes the session, yamux does not transmit the error code and reason.
+func (s *muxSession) CloseWithError(_ ErrorCode, _ string) error {
+	_ = s.mux.GoAway()
+	return s.mux.Close()
+}
+
+// HandshakeComplete is closed, the TLS handshake completes before the session is created.
+func (s *muxSession) HandshakeComplete() <-chan struct{} { return handshakeCompleted }
+
+func (s *muxSession) ConnectionState() tls.ConnectionState { return s.state }
+func (s *muxSession) LocalAddr() net.Addr                  { return s.mux.LocalAddr() }
+func (s *muxSession) RemoteAddr() net.Addr                 { return s.mux.RemoteAddr() }
+func (s *muxSession) Context() context.Context             { return s.ctx }
+func (s *muxSession) ID() string                           { return s.id }
+func (s *muxSession) Transport() string                    { return s.transport }
+
+type tcpListener struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	conf      MuxConfig
+	logger    *logger.Logger
+
+	sessions  chan Session
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// ListenTCP listens for the sessions multiplexed over TLS connections.
+func ListenTCP(addr string, tlsConfig *tls.Config, conf MuxConfig) (Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPListener(ln, tlsConfig, conf), nil
+}
+
+func NewTCPListener(ln net.Listener, tlsConfig *tls.Config, conf MuxConfig) Listener {
+	l := &tcpListener{
+		ln:        ln,
+		tlsConfig: tlsConfig,
+		conf:      conf,
+		logger:    logger.GetInstance().WithFields(map[string]any{"kind": "tcp-listener"}),
+		sessions:  make(chan Session),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *tcpListener) run() {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			l.close(err)
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake completes the TLS handshake outside the accept loop, a slow client does not block the others.
+func (l *tcpListener) handshake(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.conf.handshakeTimeout())
+	defer cancel()
+	tlsConn := tls.Server(conn, l.tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		l.logger.Debug("tls handshake failure", slog.String("remote", conn.RemoteAddr().String()), slog.String("error", err.Error()))
+		_ = conn.Close()
+		return
+	}
+	sess, err := NewMuxServer(tlsConn, l.conf)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	select {
+	case l.sessions <- sess:
+	case <-l.done:
+		_ = sess.CloseWithError(0, "listener closed")
+	}
+}
+
+func (l *tcpListener) Accept(ctx context.Context) (Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-l.done:
+		return nil, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *tcpListener) close(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *tcpListener) Close() error {
+	l.close(net.ErrClosed)
+	err := l.ln.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
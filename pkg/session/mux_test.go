@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestMuxSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ln, err := ListenTCP("127.0.0.1:0", testTLSConfig(t), MuxConfig{KeepAlivePeriod: time.Second})
+	require.NoError(t, err)
+	defer ln.Close()
+	addr := ln.(*tcpListener).ln.Addr().String()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	client, err := NewMuxClient(conn, MuxConfig{})
+	require.NoError(t, err)
+	require.Equal(t, TransportTCP, client.Transport())
+
+	server, err := ln.Accept(ctx)
+	require.NoError(t, err)
+	require.Equal(t, tls.VersionTLS13, int(server.ConnectionState().Version))
+	require.NotEqual(t, client.ID(), server.ID())
+
+	// the agent echoes the streams opened by the proxy until EOF
+	go func() {
+		stream, err := client.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(stream, stream)
+		_ = stream.CloseWrite()
+	}()
+	stream, err := server.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	_, err = stream.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseWrite())
+	// the half-closed stream receives the echo and EOF
+	response, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(response))
+	require.Positive(t, StreamID(stream))
+
+	require.NoError(t, server.CloseWithError(0, "done"))
+	select {
+	case <-client.Context().Done():
+	case <-ctx.Done():
+		t.Fatal("client session was not closed")
+	}
+}
+
+func TestDialTCPHandshakeTimeout(t *testing.T) {
+	// the server accepts the connection but never answers the TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	start := time.Now()
+	_, err = DialTCP(context.Background(), ln.Addr().String(), &tls.Config{InsecureSkipVerify: true}, MuxConfig{HandshakeTimeout: 200 * time.Millisecond})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"reflect"
+
+	"github.com/grepplabs/reverse-http/pkg/util"
+	"github.com/quic-go/quic-go"
+)
+
+type quicSession struct {
+	conn quic.Connection
+	id   string
+}
+
+// NewQuic creates the session over the QUIC connection.
+func NewQuic(conn quic.Connection) Session {
+	return &quicSession{
+		conn: conn,
+		id:   quicConnID(conn),
+	}
+}
+
+func (s *quicSession) OpenStreamSync(ctx context.Context) (Stream, error) {
+	stream, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(stream), nil
+}
+
+func (s *quicSession) AcceptStream(ctx context.Context) (Stream, error) {
+	stream, err := s.conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(stream), nil
+}
+
+func (s *quicSession) wrap(stream quic.Stream) Stream {
+	return &util.QuicConn{
+		Stream: stream,
+		LAddr:  s.conn.LocalAddr(),
+		RAddr:  s.conn.RemoteAddr(),
+	}
+}
+
+func (s *quicSession) ConnectionState() tls.ConnectionState {
+	return s.conn.ConnectionState().TLS
+}
+
+func (s *quicSession) CloseWithError(code ErrorCode, reason string) error {
+	return s.conn.CloseWithError(quic.ApplicationErrorCode(code), reason)
+}
+
+func (s *quicSession) HandshakeComplete() <-chan struct{} {
+	if conn, ok := s.conn.(quic.EarlyConnection); ok {
+		return conn.HandshakeComplete()
+	}
+	return handshakeCompleted
+}
+
+func (s *quicSession) LocalAddr() net.Addr      { return s.conn.LocalAddr() }
+func (s *quicSession) RemoteAddr() net.Addr     { return s.conn.RemoteAddr() }
+func (s *quicSession) Context() context.Context { return s.conn.Context() }
+func (s *quicSession) ID() string               { return s.id }
+func (s *quicSession) Transport() string        { return TransportQuic }
+
+// quicConnID returns the connection ID used by the QUIC logging.
+func quicConnID(conn quic.Connection) string {
+	if conn == nil {
+		return ""
+	}
+	reflectValue := reflect.Indirect(reflect.ValueOf(conn))
+	if reflectValue.Kind() == reflect.Struct {
+		fieldVal := reflectValue.FieldByName("logID")
+		if fieldVal.IsValid() {
+			return fieldVal.String()
+		}
+	}
+	return ""
+}
+
+type quicListener struct {
+	ln interface {
+		Close() error
+	}
+	accept func(ctx context.Context) (quic.Connection, error)
+}
+
+// ListenQuic listens for the QUIC sessions, with 0-RTT the connections are accepted before the handshake completes
+// and the client identity is verified when the session HandshakeComplete is closed.
+func ListenQuic(addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (Listener, error) {
+	if quicConfig.Allow0RTT {
+		ln, err := quic.ListenAddrEarly(addr, tlsConfig, quicConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &quicListener{ln: ln, accept: func(ctx context.Context) (quic.Connection, error) {
+			return ln.Accept(ctx)
+		}}, nil
+	}
+	ln, err := quic.ListenAddr(addr, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &quicListener{ln: ln, accept: ln.Accept}, nil
+}
+
+func (l *quicListener) Accept(ctx context.Context) (Session, error) {
+	conn, err := l.accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewQuic(conn), nil
+}
+
+func (l *quicListener) Close() error {
+	return l.ln.Close()
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/grepplabs/reverse-http/pkg/util"
+)
+
+const (
+	TransportQuic      = "quic"
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+)
+
+// ErrorCode is the application error code sent to the peer when the session is closed.
+type ErrorCode uint64
+
+// Stream is a bidirectional stream of the session.
+type Stream interface {
+	net.Conn
+	// CloseWrite closes the write direction, the peer receives EOF.
+	CloseWrite() error
+}
+
+// Session is the multiplexed connection between the agent and the proxy. The proxy opens a stream for every tunnel,
+// the agent opens the streams for the authentication.
+type Session interface {
+	OpenStreamSync(ctx context.Context) (Stream, error)
+	AcceptStream(ctx context.Context) (Stream, error)
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	ConnectionState() tls.ConnectionState
+	// HandshakeComplete is closed when the peer is verified by the handshake, the 0-RTT sessions are accepted before.
+	HandshakeComplete() <-chan struct{}
+	// Context is done when the session is closed.
+	Context() context.Context
+	CloseWithError(code ErrorCode, reason string) error
+	// ID identifies the session in the logs.
+	ID() string
+	Transport() string
+}
+
+// Listener accepts the agent sessions.
+type Listener interface {
+	Accept(ctx context.Context) (Session, error)
+	Close() error
+}
+
+// handshakeCompleted is the closed channel of the sessions without the early data.
+var handshakeCompleted = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// StreamID returns the transport stream ID for the logs.
+func StreamID(stream Stream) int64 {
+	switch s := stream.(type) {
+	case *util.QuicConn:
+		return int64(s.StreamID())
+	case *muxStream:
+		return int64(s.StreamID())
+	}
+	return 0
+}
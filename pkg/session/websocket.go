@@ -0,0 +1,281 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+	"golang.org/x/net/websocket"
+)
+
+// wsConn is the WebSocket connection with the addresses and the TLS state of the underlying connection. The
+// WebSocket addresses are the URL and the origin.
+type wsConn struct {
+	*websocket.Conn
+	local  net.Addr
+	remote net.Addr
+	state  tls.ConnectionState
+}
+
+func (c *wsConn) LocalAddr() net.Addr                  { return c.local }
+func (c *wsConn) RemoteAddr() net.Addr                 { return c.remote }
+func (c *wsConn) ConnectionState() tls.ConnectionState { return c.state }
+
+// webSocketNextProtos is the ALPN of the WebSocket, the HTTP server closes the connections with other protocols.
+var webSocketNextProtos = []string{"http/1.1"}
+
+// webSocketTLSConfig replaces the ALPN of the agent server TLS config, also in the per-client configs.
+func webSocketTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = webSocketNextProtos
+	if getConfigForClient := tlsConfig.GetConfigForClient; getConfigForClient != nil {
+		tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			conf, err := getConfigForClient(hello)
+			if err != nil || conf == nil {
+				return conf, err
+			}
+			conf = conf.Clone()
+			conf.NextProtos = webSocketNextProtos
+			return conf, nil
+		}
+	}
+	return tlsConfig
+}
+
+// ProxyFunc returns the HTTP proxy for the request, nil URL connects directly e.g. http.ProxyFromEnvironment.
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// DialWebSocket connects the session multiplexed over the WebSocket. The wss:// connection is tunneled through
+// the HTTP proxy with CONNECT, the TLS is end-to-end between the agent and the proxy.
+func DialWebSocket(ctx context.Context, wsURL string, proxy ProxyFunc, tlsConfig *tls.Config, conf MuxConfig) (Session, error) {
+	location, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, fmt.Errorf("websocket url: %w", err)
+	}
+	if location.Scheme != "wss" {
+		return nil, fmt.Errorf("websocket url scheme must be wss: %s", wsURL)
+	}
+	addr := hostPort(location, "443")
+
+	ctx, cancel := context.WithTimeout(ctx, conf.handshakeTimeout())
+	defer cancel()
+
+	var proxyURL *url.URL
+	if proxy != nil {
+		proxyURL, err = proxy(&http.Request{Method: http.MethodConnect, URL: &url.URL{Scheme: "https", Host: location.Host}})
+		if err != nil {
+			return nil, fmt.Errorf("http proxy: %w", err)
+		}
+	}
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialHTTPProxy(ctx, proxyURL, addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess, err := newWebSocketClient(ctx, conn, location, tlsConfig, conf)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+func newWebSocketClient(ctx context.Context, conn net.Conn, location *url.URL, tlsConfig *tls.Config, conf MuxConfig) (Session, error) {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = webSocketNextProtos
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = location.Hostname()
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	// the WebSocket handshake is not context aware
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = tlsConn.SetDeadline(deadline)
+	}
+	wsConfig, err := websocket.NewConfig(location.String(), "https://"+location.Host)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocket.NewClient(wsConfig, tlsConn)
+	if err != nil {
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+	ws.PayloadType = websocket.BinaryFrame
+	return newMuxClient(&wsConn{
+		Conn:   ws,
+		local:  tlsConn.LocalAddr(),
+		remote: tlsConn.RemoteAddr(),
+		state:  tlsConn.ConnectionState(),
+	}, conf, TransportWebSocket)
+}
+
+// dialHTTPProxy opens the tunnel to the address through the HTTP proxy with CONNECT.
+func dialHTTPProxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	var conn net.Conn
+	var err error
+	switch proxyURL.Scheme {
+	case "http", "":
+		conn, err = dialer.DialContext(ctx, "tcp", hostPort(proxyURL, "80"))
+	case "https":
+		tlsDialer := &tls.Dialer{NetDialer: &dialer}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", hostPort(proxyURL, "443"))
+	default:
+		return nil, fmt.Errorf("unsupported http proxy scheme: %s", proxyURL.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("http proxy dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err = req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy connect: %w", err)
+	}
+	// the buffered reader can be dropped, the TLS server does not send before the client hello
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy connect: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy connect: %s", resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if port := u.Port(); port != "" {
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+type webSocketListener struct {
+	server *http.Server
+	conf   MuxConfig
+	logger *logger.Logger
+
+	sessions  chan Session
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// ListenWebSocket listens for the sessions multiplexed over wss:// connections on the path.
+func ListenWebSocket(addr string, path string, tlsConfig *tls.Config, conf MuxConfig) (Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebSocketListener(ln, path, tlsConfig, conf), nil
+}
+
+func NewWebSocketListener(ln net.Listener, path string, tlsConfig *tls.Config, conf MuxConfig) Listener {
+	l := &webSocketListener{
+		conf:     conf,
+		logger:   logger.GetInstance().WithFields(map[string]any{"kind": "websocket-listener"}),
+		sessions: make(chan Session),
+		done:     make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, websocket.Server{
+		// the agents are not browsers, the origin is not checked
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   l.serve,
+	})
+	l.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: conf.handshakeTimeout(),
+		ErrorLog:          slog.NewLogLogger(l.logger.Handler(), slog.LevelDebug),
+	}
+	go func() {
+		l.close(l.server.Serve(tls.NewListener(ln, webSocketTLSConfig(tlsConfig))))
+	}()
+	return l
+}
+
+// serve passes the session to Accept, the WebSocket is closed when the handler returns.
+func (l *webSocketListener) serve(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+	req := ws.Request()
+	conn := &wsConn{Conn: ws}
+	conn.local, _ = req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if remote, err := net.ResolveTCPAddr("tcp", req.RemoteAddr); err == nil {
+		conn.remote = remote
+	}
+	if req.TLS != nil {
+		conn.state = *req.TLS
+	}
+	sess, err := newMuxServer(conn, l.conf, TransportWebSocket)
+	if err != nil {
+		l.logger.Debug("websocket session failure", slog.String("remote", req.RemoteAddr), slog.String("error", err.Error()))
+		return
+	}
+	select {
+	case l.sessions <- sess:
+	case <-l.done:
+		_ = sess.CloseWithError(0, "listener closed")
+		return
+	}
+	<-sess.Context().Done()
+}
+
+func (l *webSocketListener) Accept(ctx context.Context) (Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-l.done:
+		return nil, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *webSocketListener) close(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *webSocketListener) Close() error {
+	l.close(net.ErrClosed)
+	err := l.server.Close()
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
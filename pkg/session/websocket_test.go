@@ -0,0 +1,165 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// connectProxy is the HTTP proxy stand-in, it tunnels the CONNECT requests with the expected credentials.
+type connectProxy struct {
+	ln            net.Listener
+	authorization string
+	connects      atomic.Int32
+}
+
+func newConnectProxy(t *testing.T, authorization string) *connectProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &connectProxy{ln: ln, authorization: authorization}
+	t.Cleanup(func() { _ = ln.Close() })
+	go p.run()
+	return p
+}
+
+func (p *connectProxy) run() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *connectProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	if req.Method != http.MethodConnect {
+		_, _ = io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return
+	}
+	if req.Header.Get("Proxy-Authorization") != p.authorization {
+		_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+	p.connects.Add(1)
+	_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func (p *connectProxy) url(user *url.Userinfo) *url.URL {
+	return &url.URL{Scheme: "http", Host: p.ln.Addr().String(), User: user}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := NewWebSocketListener(tcpLn, "/agent", testTLSConfig(t), MuxConfig{KeepAlivePeriod: time.Second})
+	defer ln.Close()
+	wsURL := "wss://" + tcpLn.Addr().String() + "/agent"
+	// QWxhZGRpbjpvcGVuIHNlc2FtZQ== is Aladdin:open sesame
+	proxy := newConnectProxy(t, "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==")
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	tests := []struct {
+		name    string
+		url     string
+		proxy   ProxyFunc
+		wantErr string
+	}{
+		{
+			name:  "through proxy",
+			url:   wsURL,
+			proxy: http.ProxyURL(proxy.url(url.UserPassword("Aladdin", "open sesame"))),
+		},
+		{
+			name: "direct",
+			url:  wsURL,
+		},
+		{
+			name:    "proxy authentication required",
+			url:     wsURL,
+			proxy:   http.ProxyURL(proxy.url(nil)),
+			wantErr: "http proxy connect: 407 Proxy Authentication Required",
+		},
+		{
+			name:    "wrong path",
+			url:     "wss://" + tcpLn.Addr().String() + "/other",
+			wantErr: "websocket handshake",
+		},
+		{
+			name:    "plain websocket",
+			url:     "ws://" + tcpLn.Addr().String() + "/agent",
+			wantErr: "websocket url scheme must be wss",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := DialWebSocket(ctx, tc.url, tc.proxy, tlsConfig, MuxConfig{})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer client.CloseWithError(0, "done")
+			require.Equal(t, TransportWebSocket, client.Transport())
+			require.IsType(t, &net.TCPAddr{}, client.RemoteAddr())
+
+			server, err := ln.Accept(ctx)
+			require.NoError(t, err)
+			require.Equal(t, TransportWebSocket, server.Transport())
+			require.Equal(t, tls.VersionTLS13, int(server.ConnectionState().Version))
+			require.IsType(t, &net.TCPAddr{}, server.RemoteAddr())
+
+			go func() {
+				stream, err := client.AcceptStream(ctx)
+				if err != nil {
+					return
+				}
+				_, _ = io.Copy(stream, stream)
+				_ = stream.CloseWrite()
+			}()
+			stream, err := server.OpenStreamSync(ctx)
+			require.NoError(t, err)
+			_, err = stream.Write([]byte("ping"))
+			require.NoError(t, err)
+			require.NoError(t, stream.CloseWrite())
+			response, err := io.ReadAll(stream)
+			require.NoError(t, err)
+			require.Equal(t, "ping", string(response))
+
+			require.NoError(t, server.CloseWithError(0, "done"))
+			select {
+			case <-client.Context().Done():
+			case <-ctx.Done():
+				t.Fatal("client session was not closed")
+			}
+		})
+	}
+	require.Equal(t, int32(1), proxy.connects.Load())
+}
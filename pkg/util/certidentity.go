@@ -0,0 +1,91 @@
+package util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	CertIdentityCN     = "cn"
+	CertIdentitySANURI = "san-uri"
+	CertIdentityOID    = "oid"
+)
+
+// CertIdentityExtractor reads the identity from the certificate subject or SAN.
+type CertIdentityExtractor struct {
+	source    string
+	uriPrefix string
+	oid       asn1.ObjectIdentifier
+}
+
+// NewCertIdentityExtractor creates the extractor for the source cn, san-uri or oid. For san-uri, the first URI
+// with the prefix is used and the prefix is removed. For oid, the value of the subject attribute with the OID is used.
+func NewCertIdentityExtractor(source string, uriPrefix string, oid string) (*CertIdentityExtractor, error) {
+	e := &CertIdentityExtractor{source: source, uriPrefix: uriPrefix}
+	switch source {
+	case CertIdentityCN, CertIdentitySANURI:
+	case CertIdentityOID:
+		parsed, err := ParseOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		e.oid = parsed
+	default:
+		return nil, fmt.Errorf("unsupported certificate identity source: %s", source)
+	}
+	return e, nil
+}
+
+func (e *CertIdentityExtractor) Identity(cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", errors.New("missing client certificate")
+	}
+	switch e.source {
+	case CertIdentityCN:
+		if cert.Subject.CommonName == "" {
+			return "", errors.New("certificate without common name")
+		}
+		return cert.Subject.CommonName, nil
+	case CertIdentitySANURI:
+		for _, uri := range cert.URIs {
+			value := uri.String()
+			if strings.HasPrefix(value, e.uriPrefix) && len(value) > len(e.uriPrefix) {
+				return strings.TrimPrefix(value, e.uriPrefix), nil
+			}
+		}
+		return "", fmt.Errorf("certificate without SAN URI with prefix %q", e.uriPrefix)
+	case CertIdentityOID:
+		for _, name := range cert.Subject.Names {
+			if !name.Type.Equal(e.oid) {
+				continue
+			}
+			if value, ok := name.Value.(string); ok && value != "" {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("certificate without subject attribute %s", e.oid)
+	default:
+		return "", fmt.Errorf("unsupported certificate identity source: %s", e.source)
+	}
+}
+
+// ParseOID parses the dotted OID notation e.g. 1.3.6.1.4.1.57264.1.1
+func ParseOID(oid string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(oid, ".")
+	if oid == "" || len(parts) < 2 {
+		return nil, fmt.Errorf("invalid oid: %q", oid)
+	}
+	result := make(asn1.ObjectIdentifier, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid oid: %q", oid)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertIdentity(t *testing.T) {
+	agentOID := []int{1, 3, 6, 1, 4, 1, 99999, 1}
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "agent-cn",
+			Names: []pkix.AttributeTypeAndValue{
+				{Type: agentOID, Value: "agent-oid"},
+			},
+		},
+		URIs: []*url.URL{
+			{Scheme: "https", Host: "example.com"},
+			{Scheme: "spiffe", Host: "example.org", Path: "/agent/agent-uri"},
+		},
+	}
+	tests := []struct {
+		name      string
+		source    string
+		uriPrefix string
+		oid       string
+		cert      *x509.Certificate
+		identity  string
+		err       string
+	}{
+		{name: "cn", source: CertIdentityCN, cert: cert, identity: "agent-cn"},
+		{name: "cn missing", source: CertIdentityCN, cert: &x509.Certificate{}, err: "without common name"},
+		{name: "san uri", source: CertIdentitySANURI, uriPrefix: "spiffe://example.org/agent/", cert: cert, identity: "agent-uri"},
+		{name: "san uri no prefix", source: CertIdentitySANURI, cert: cert, identity: "https://example.com"},
+		{name: "san uri missing", source: CertIdentitySANURI, uriPrefix: "spiffe://other/", cert: cert, err: "without SAN URI"},
+		{name: "oid", source: CertIdentityOID, oid: "1.3.6.1.4.1.99999.1", cert: cert, identity: "agent-oid"},
+		{name: "oid missing", source: CertIdentityOID, oid: "1.3.6.1.4.1.99999.2", cert: cert, err: "without subject attribute"},
+		{name: "no certificate", source: CertIdentityCN, err: "missing client certificate"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			extractor, err := NewCertIdentityExtractor(tc.source, tc.uriPrefix, tc.oid)
+			require.NoError(t, err)
+			identity, err := extractor.Identity(tc.cert)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.identity, identity)
+		})
+	}
+}
+
+func TestCertIdentityInvalidConfig(t *testing.T) {
+	_, err := NewCertIdentityExtractor("dns", "", "")
+	require.ErrorContains(t, err, "unsupported certificate identity source")
+	_, err = NewCertIdentityExtractor(CertIdentityOID, "", "1.x")
+	require.ErrorContains(t, err, "invalid oid")
+	_, err = NewCertIdentityExtractor(CertIdentityOID, "", "")
+	require.ErrorContains(t, err, "invalid oid")
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+)
+
+// FileWatcher reloads the file content when its modification time or size changes.
+type FileWatcher struct {
+	filename string
+	onChange func(content []byte) error
+	logger   *logger.Logger
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+func NewFileWatcher(filename string, onChange func(content []byte) error) *FileWatcher {
+	return &FileWatcher{
+		filename: filename,
+		onChange: onChange,
+		logger:   logger.GetInstance().WithFields(map[string]any{"kind": "file-watcher", "file": filename}),
+	}
+}
+
+// Load reads the file and calls the change handler unconditionally.
+func (w *FileWatcher) Load() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		return err
+	}
+	return w.load(info)
+}
+
+func (w *FileWatcher) load(info os.FileInfo) error {
+	content, err := os.ReadFile(w.filename)
+	if err != nil {
+		return err
+	}
+	if err = w.onChange(content); err != nil {
+		return err
+	}
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return nil
+}
+
+// Reload reloads the file if it was changed since the last successful load.
+func (w *FileWatcher) Reload() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+	return true, w.load(info)
+}
+
+// Watch checks the file for changes until the context is done. Failed reloads keep the previous content.
+func (w *FileWatcher) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := w.Reload()
+			if err != nil {
+				w.logger.Warnf("reload failed: %v", err)
+			} else if changed {
+				w.logger.Info("file reloaded")
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"net"
 
+	"github.com/grepplabs/reverse-http/config"
 	"github.com/quic-go/quic-go"
 )
 
@@ -19,3 +20,29 @@ func (c *QuicConn) LocalAddr() net.Addr {
 func (c *QuicConn) RemoteAddr() net.Addr {
 	return c.RAddr
 }
+
+// CloseWrite closes the write direction of the stream, the peer receives the stream FIN.
+func (c *QuicConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+// Close closes both directions of the stream.
+func (c *QuicConn) Close() error {
+	c.Stream.CancelRead(0)
+	return c.Stream.Close()
+}
+
+// NewQuicConfig creates the QUIC transport configuration.
+func NewQuicConfig(conf config.QuicConfig) *quic.Config {
+	return &quic.Config{
+		MaxIncomingStreams:             conf.MaxIncomingStreams,
+		InitialStreamReceiveWindow:     conf.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         conf.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: conf.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     conf.MaxConnectionReceiveWindow,
+		MaxIdleTimeout:                 conf.MaxIdleTimeout,
+		HandshakeIdleTimeout:           conf.HandshakeIdleTimeout,
+		KeepAlivePeriod:                conf.KeepAlivePeriod,
+		Allow0RTT:                      conf.Allow0RTT,
+	}
+}
@@ -7,38 +7,88 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/grepplabs/reverse-http/pkg/gost"
 	"github.com/grepplabs/reverse-http/pkg/logger"
 )
 
-type Entry[T any] struct {
-	Value   T
+const (
+	// denyPrefix marks the deny rules e.g. !secrets.corp.local
+	denyPrefix = "!"
+	// anyPattern matches all destinations, the last rule * or !* is the explicit default action.
+	anyPattern = "*"
+)
+
+// Rule is an allow or deny rule for a network, an IP, a DNS zone, a host or any destination, optionally limited
+// to a port range.
+type Rule struct {
+	Deny    bool
+	Any     bool
+	Network *net.IPNet
+	IP      net.IP
+	Zone    string
+	Host    string
 	MinPort int
 	MaxPort int
 }
 
-func (e Entry[T]) String() string {
-	if e.MinPort == 0 && e.MaxPort == 0 {
-		return fmt.Sprintf("%v", e.Value)
-	} else {
-		return fmt.Sprintf("%v (%d,%d)", e.Value, e.MinPort, e.MaxPort)
+func (r Rule) String() string {
+	var value string
+	switch {
+	case r.Any:
+		value = anyPattern
+	case r.Network != nil:
+		value = r.Network.String()
+	case r.IP != nil:
+		value = r.IP.String()
+	case r.Zone != "":
+		value = "*" + r.Zone
+	default:
+		value = r.Host
+	}
+	if r.Deny {
+		value = denyPrefix + value
 	}
+	if r.MinPort == 0 && r.MaxPort == 0 {
+		return value
+	}
+	return fmt.Sprintf("%s (%d,%d)", value, r.MinPort, r.MaxPort)
 }
 
-func (e Entry[T]) IsPortAllowed(port int) bool {
-	if e.MinPort == 0 && e.MaxPort == 0 {
+func (r Rule) IsPortAllowed(port int) bool {
+	if r.MinPort == 0 && r.MaxPort == 0 {
 		return true
 	}
-	return e.MinPort <= port && port <= e.MaxPort
+	return r.MinPort <= port && port <= r.MaxPort
 }
 
+// matches returns true when the destination and the port match the rule, the ip is nil for the host names.
+func (r Rule) matches(host string, ip net.IP, port int) bool {
+	if !r.IsPortAllowed(port) {
+		return false
+	}
+	switch {
+	case r.Any:
+		return true
+	case ip != nil:
+		if r.Network != nil {
+			return r.Network.Contains(ip)
+		}
+		return r.IP != nil && r.IP.Equal(ip)
+	case r.Zone != "":
+		// For a zone ".example.com", we match "example.com" too.
+		return strings.HasSuffix(host, r.Zone) || host == r.Zone[1:]
+	default:
+		return r.Host != "" && r.Host == host
+	}
+}
+
+// Whitelist evaluates the ordered allow and deny rules top-down, the first matching rule decides. The destinations
+// without a matching rule are blocked. The rules can be replaced while the whitelist is in use.
 type Whitelist struct {
-	Networks []Entry[*net.IPNet]
-	IPs      []Entry[net.IP]
-	Zones    []Entry[string]
-	Hosts    []Entry[string]
-	logger   *logger.Logger
+	rules  atomic.Pointer[[]Rule]
+	logger *logger.Logger
 }
 
 func NewWhitelist() *Whitelist {
@@ -83,6 +133,9 @@ func (p *Whitelist) Contains(ctx context.Context, network, addr string, opts ...
 	// [2001:db8::1]
 	// [2001:db8::1]:80
 	// [2001:db8::1]:1000-2000
+	// !secrets.zone
+	// *
+	// *:443
 	host, destPort, err := net.SplitHostPort(addr)
 	if err != nil {
 		p.logger.Error("blocked", slog.String("error", err.Error()))
@@ -99,124 +152,128 @@ func (p *Whitelist) Contains(ctx context.Context, network, addr string, opts ...
 	return blocked
 }
 
-func (p *Whitelist) IsPortAllowed(port int, entry *Entry[any]) bool {
-	if entry.MinPort == 0 && entry.MaxPort == 0 {
-		return true
-	}
-	return entry.MinPort <= port && port <= entry.MaxPort
+// IsAddrAllowed returns the action of the first rule matching the host and the port, false without a matching rule.
+func (p *Whitelist) IsAddrAllowed(host string, port int) bool {
+	rule, ok := p.Match(host, port)
+	return ok && !rule.Deny
 }
 
-func (p *Whitelist) IsAddrAllowed(host string, port int) bool {
-	if ip := net.ParseIP(host); ip != nil {
-		for _, ipNet := range p.Networks {
-			if ipNet.Value.Contains(ip) {
-				// return true
-				return ipNet.IsPortAllowed(port)
-			}
+// Match returns the first rule matching the host and the port.
+func (p *Whitelist) Match(host string, port int) (Rule, bool) {
+	ip := net.ParseIP(host)
+	for _, rule := range p.Rules() {
+		if rule.matches(host, ip, port) {
+			return rule, true
 		}
-		for _, bypassIP := range p.IPs {
-			if bypassIP.Value.Equal(ip) {
-				// return true
-				return bypassIP.IsPortAllowed(port)
-			}
-		}
-		return false
 	}
+	return Rule{}, false
+}
 
-	for _, zone := range p.Zones {
-		if strings.HasSuffix(host, zone.Value) {
-			// return true
-			return zone.IsPortAllowed(port)
-		}
-		if host == zone.Value[1:] {
-			// For a zone ".example.com", we match "example.com" too.
-			// return true
-			return zone.IsPortAllowed(port)
+// MatchIP returns the first IP or network rule matching the address and the port, the host and the catch-all
+// rules are skipped.
+func (p *Whitelist) MatchIP(ip net.IP, port int) (Rule, bool) {
+	for _, rule := range p.Rules() {
+		if (rule.IP != nil || rule.Network != nil) && rule.matches(ip.String(), ip, port) {
+			return rule, true
 		}
 	}
-	for _, bypassHost := range p.Hosts {
-		if bypassHost.Value == host {
-			//return true
-			return bypassHost.IsPortAllowed(port)
-		}
+	return Rule{}, false
+}
+
+// Rules returns the current rules in the evaluation order.
+func (p *Whitelist) Rules() []Rule {
+	if rules := p.rules.Load(); rules != nil {
+		return *rules
 	}
-	return false
+	return nil
 }
 
+// SetRules replaces the rules atomically, the checks in progress finish with the previous rules.
+func (p *Whitelist) SetRules(rules []Rule) {
+	p.rules.Store(&rules)
+}
+
+func (p *Whitelist) add(rule Rule) {
+	rules := append(append([]Rule(nil), p.Rules()...), rule)
+	p.rules.Store(&rules)
+}
+
+// AddFromString adds the comma separated rules in order, the deny rules start with !. Invalid rules are skipped.
 func (p *Whitelist) AddFromString(s string) {
-	entries := strings.Split(s, ",")
-	for _, entry := range entries {
-		host, minPort, maxPort, err := toAddrPorts(entry)
-		if err != nil {
-			continue
-		}
-		host = strings.TrimSpace(host)
-		if len(host) == 0 {
-			continue
-		}
-		if strings.Contains(host, "/") {
-			// We assume that it's a CIDR address like 127.0.0.0/8
-			if _, ipNet, err := net.ParseCIDR(host); err == nil {
-				p.AddNetwork(ipNet, minPort, maxPort)
-			}
-			continue
+	for _, entry := range strings.Split(s, ",") {
+		if rule, err := ParseRule(entry); err == nil {
+			p.add(rule)
 		}
-		if ip := net.ParseIP(host); ip != nil {
-			p.AddIP(ip, minPort, maxPort)
-			continue
-		}
-		if strings.HasPrefix(host, "*.") {
-			p.AddZone(host[1:], minPort, maxPort)
-			continue
+	}
+}
+
+// ParseRule parses a whitelist pattern, the deny rules start with !.
+func ParseRule(entry string) (Rule, error) {
+	entry = strings.TrimSpace(entry)
+	deny := strings.HasPrefix(entry, denyPrefix)
+	host, minPort, maxPort, err := toAddrPorts(strings.TrimPrefix(entry, denyPrefix))
+	if err != nil {
+		return Rule{}, err
+	}
+	host = strings.TrimSpace(host)
+	if len(host) == 0 {
+		return Rule{}, fmt.Errorf("invalid rule: %s", entry)
+	}
+	rule := Rule{Deny: deny, MinPort: minPort, MaxPort: maxPort}
+	switch {
+	case host == anyPattern:
+		rule.Any = true
+	case strings.Contains(host, "/"):
+		// We assume that it's a CIDR address like 127.0.0.0/8
+		_, ipNet, err := net.ParseCIDR(host)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid rule %s: %w", entry, err)
 		}
-		p.AddHost(host, minPort, maxPort)
+		rule.Network = ipNet
+	case net.ParseIP(host) != nil:
+		rule.IP = net.ParseIP(host)
+	case strings.HasPrefix(host, "*."):
+		rule.Zone = normalizeZone(host[1:])
+	case strings.ContainsAny(host, "*:[] "):
+		return Rule{}, fmt.Errorf("invalid rule: %s", entry)
+	default:
+		rule.Host = strings.TrimSuffix(host, ".")
 	}
+	return rule, nil
 }
 
 // AddIP specifies an IP address that will use the bypass proxy. Note that
 // this will only take effect if a literal IP address is dialed. A connection
 // to a named host will never match an IP.
 func (p *Whitelist) AddIP(ip net.IP, minPort, maxPort int) {
-	p.IPs = append(p.IPs, Entry[net.IP]{
-		Value:   ip,
-		MinPort: minPort,
-		MaxPort: maxPort,
-	})
+	p.add(Rule{IP: ip, MinPort: minPort, MaxPort: maxPort})
 }
 
 // AddNetwork specifies an IP range that will use the bypass proxy. Note that
 // this will only take effect if a literal IP address is dialed. A connection
 // to a named host will never match.
 func (p *Whitelist) AddNetwork(ipNet *net.IPNet, minPort, maxPort int) {
-	p.Networks = append(p.Networks, Entry[*net.IPNet]{
-		Value:   ipNet,
-		MinPort: minPort,
-		MaxPort: maxPort,
-	})
+	p.add(Rule{Network: ipNet, MinPort: minPort, MaxPort: maxPort})
 }
 
 // AddZone specifies a DNS suffix that will use the bypass proxy. A zone of
 // "example.com" matches "example.com" and all of its subdomains.
 func (p *Whitelist) AddZone(zone string, minPort, maxPort int) {
-	zone = strings.TrimSuffix(zone, ".")
-	if !strings.HasPrefix(zone, ".") {
-		zone = "." + zone
-	}
-	p.Zones = append(p.Zones, Entry[string]{
-		Value:   zone,
-		MinPort: minPort,
-		MaxPort: maxPort,
-	})
+	p.add(Rule{Zone: normalizeZone(zone), MinPort: minPort, MaxPort: maxPort})
 }
 
 // AddHost specifies a host name that will use the bypass proxy.
 func (p *Whitelist) AddHost(host string, minPort, maxPort int) {
 	host = strings.TrimSuffix(host, ".")
-	p.Hosts = append(p.Hosts, Entry[string]{
-		Value:   host,
-		MinPort: minPort,
-		MaxPort: maxPort,
-	})
+	p.add(Rule{Host: host, MinPort: minPort, MaxPort: maxPort})
+}
+
+func normalizeZone(zone string) string {
+	zone = strings.TrimSuffix(zone, ".")
+	if !strings.HasPrefix(zone, ".") {
+		zone = "." + zone
+	}
+	return zone
 }
 
 func toAddrPorts(input string) (string, int, int, error) {
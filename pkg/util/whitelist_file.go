@@ -0,0 +1,123 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/logger"
+)
+
+// WhitelistFile keeps the whitelist rules of the static patterns followed by the rules of a file. The file is
+// reloaded on changes, an invalid file keeps the current rules. Without any rule all destinations are allowed
+// like with the empty host whitelist.
+type WhitelistFile struct {
+	whitelist *Whitelist
+	static    []Rule
+	watcher   *FileWatcher
+	logger    *logger.Logger
+}
+
+// NewWhitelistFile loads the rules file, the static patterns e.g. from the command line are evaluated first.
+func NewWhitelistFile(filename string, static []string) (*WhitelistFile, error) {
+	f := &WhitelistFile{
+		whitelist: NewWhitelist(),
+		logger:    logger.GetInstance().WithFields(map[string]any{"kind": "whitelist-file"}),
+	}
+	for _, s := range static {
+		f.whitelist.AddFromString(s)
+	}
+	f.static = f.whitelist.Rules()
+	f.watcher = NewFileWatcher(filename, f.update)
+	if err := f.watcher.Load(); err != nil {
+		return nil, fmt.Errorf("whitelist file %s: %w", filename, err)
+	}
+	return f, nil
+}
+
+// Whitelist returns the whitelist, its rules are swapped on the file changes.
+func (f *WhitelistFile) Whitelist() *Whitelist {
+	return f.whitelist
+}
+
+// Watch reloads the file on changes until the context is done.
+func (f *WhitelistFile) Watch(ctx context.Context, interval time.Duration) {
+	f.watcher.Watch(ctx, interval)
+}
+
+func (f *WhitelistFile) update(content []byte) error {
+	rules, err := ParseWhitelistRules(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	rules = append(append([]Rule(nil), f.static...), rules...)
+	if len(rules) == 0 {
+		f.logger.Warn("no whitelist rules, all destinations are allowed")
+		rules = []Rule{allowAllRule}
+	}
+	added, removed := diffRules(f.whitelist.Rules(), rules)
+	f.whitelist.SetRules(rules)
+	f.logger.Infof("loaded %d whitelist rules, added: [%s], removed: [%s]", len(rules), strings.Join(added, " "), strings.Join(removed, " "))
+	return nil
+}
+
+// allowAllRule replaces the empty rules of the whitelist file.
+var allowAllRule = Rule{Any: true}
+
+// ParseWhitelistRules parses the rules file, one or more comma separated patterns per line. The comments start with #.
+func ParseWhitelistRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			rule, err := ParseRule(entry)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// diffRules returns the added and the removed rules, a moved rule is not reported.
+func diffRules(previous, current []Rule) ([]string, []string) {
+	count := make(map[string]int)
+	for _, rule := range previous {
+		count[rule.String()]++
+	}
+	var added []string
+	for _, rule := range current {
+		key := rule.String()
+		if count[key] > 0 {
+			count[key]--
+			continue
+		}
+		added = append(added, key)
+	}
+	var removed []string
+	for _, rule := range previous {
+		key := rule.String()
+		if count[key] > 0 {
+			count[key]--
+			removed = append(removed, key)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhitelistFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "whitelist")
+	require.NoError(t, os.WriteFile(filename, []byte("# corp services\n!secrets.corp.local, *.corp.local\n\n10.0.0.0/8:443 # internal tls\n"), 0600))
+
+	f, err := NewWhitelistFile(filename, []string{"!10.0.0.1"})
+	require.NoError(t, err)
+	wl := f.Whitelist()
+	require.True(t, wl.IsAddrAllowed("app.corp.local", 80))
+	require.False(t, wl.IsAddrAllowed("secrets.corp.local", 80))
+	require.True(t, wl.IsAddrAllowed("10.1.2.3", 443))
+	require.False(t, wl.IsAddrAllowed("10.0.0.1", 443))
+	require.False(t, wl.IsAddrAllowed("example.com", 443))
+
+	// an invalid file keeps the current rules
+	require.NoError(t, os.WriteFile(filename, []byte("*.corp.local\n10.0.0.0/33\n"), 0600))
+	require.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Second)))
+	changed, err := f.watcher.Reload()
+	require.True(t, changed)
+	require.ErrorContains(t, err, "line 2")
+	require.False(t, wl.IsAddrAllowed("secrets.corp.local", 80))
+
+	require.NoError(t, os.WriteFile(filename, []byte("example.com:443\n"), 0600))
+	require.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(2*time.Second)))
+	changed, err = f.watcher.Reload()
+	require.True(t, changed)
+	require.NoError(t, err)
+	require.True(t, wl.IsAddrAllowed("example.com", 443))
+	require.False(t, wl.IsAddrAllowed("app.corp.local", 80))
+	require.False(t, wl.IsAddrAllowed("10.0.0.1", 443))
+	require.Len(t, wl.Rules(), 2)
+
+	_, err = NewWhitelistFile(filepath.Join(t.TempDir(), "missing"), nil)
+	require.Error(t, err)
+}
+
+func TestWhitelistFileEmpty(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "whitelist")
+	require.NoError(t, os.WriteFile(filename, []byte("# no rules\n"), 0600))
+
+	// without any rule all destinations are allowed like with the empty host whitelist
+	f, err := NewWhitelistFile(filename, nil)
+	require.NoError(t, err)
+	require.True(t, f.Whitelist().IsAddrAllowed("example.com", 443))
+
+	// the static rules are kept
+	f, err = NewWhitelistFile(filename, []string{"example.com:443"})
+	require.NoError(t, err)
+	require.True(t, f.Whitelist().IsAddrAllowed("example.com", 443))
+	require.False(t, f.Whitelist().IsAddrAllowed("example.org", 443))
+}
+
+func TestParseWhitelistRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", content: "# no rules\n"},
+		{name: "lines and commas", content: "localhost:80\n!10.0.0.1, 10.0.0.0/8 # internal\n*.zone:1000-2000\n[2001:db8::1]:443\n!*\n", want: []string{"localhost (80,80)", "!10.0.0.1", "10.0.0.0/8", "*.zone (1000,2000)", "2001:db8::1 (443,443)", "!*"}},
+		{name: "invalid network", content: "localhost\n10.0.0.0/33\n", wantErr: "line 2: invalid rule 10.0.0.0/33"},
+		{name: "invalid port", content: "localhost:http\n", wantErr: "line 1"},
+		{name: "invalid pattern", content: "app.*.local\n", wantErr: "line 1: invalid rule: app.*.local"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseWhitelistRules(strings.NewReader(tc.content))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, rule := range rules {
+				got = append(got, rule.String())
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	rules := func(patterns string) []Rule {
+		wl := NewWhitelist()
+		wl.AddFromString(patterns)
+		return wl.Rules()
+	}
+	added, removed := diffRules(rules("localhost,!10.0.0.1,*.zone"), rules("*.zone,localhost:80,!10.0.0.1"))
+	require.Equal(t, []string{"localhost (80,80)"}, added)
+	require.Equal(t, []string{"localhost"}, removed)
+
+	added, removed = diffRules(nil, rules("localhost"))
+	require.Equal(t, []string{"localhost"}, added)
+	require.Nil(t, removed)
+}
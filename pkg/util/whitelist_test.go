@@ -377,3 +377,85 @@ func TestWhitelist(t *testing.T) {
 		})
 	}
 }
+
+func TestWhitelistRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		allowed []string
+		blocked []string
+		match   map[string]string
+	}{
+		{
+			name:    "zone except host",
+			list:    "!secrets.corp.local,*.corp.local",
+			allowed: []string{"app.corp.local:443", "corp.local:80"},
+			blocked: []string{"secrets.corp.local:443", "example.com:443"},
+			match:   map[string]string{"secrets.corp.local:443": "!secrets.corp.local", "app.corp.local:443": "*.corp.local"},
+		},
+		{
+			name:    "network except ip",
+			list:    "!10.0.0.1,10.0.0.0/8",
+			allowed: []string{"10.0.0.2:22", "10.1.2.3:443"},
+			blocked: []string{"10.0.0.1:22", "192.168.0.1:22"},
+			match:   map[string]string{"10.0.0.1:22": "!10.0.0.1", "10.1.2.3:443": "10.0.0.0/8"},
+		},
+		{
+			name:    "first match wins",
+			list:    "10.0.0.0/8,!10.0.0.1",
+			allowed: []string{"10.0.0.1:22"},
+			match:   map[string]string{"10.0.0.1:22": "10.0.0.0/8"},
+		},
+		{
+			name:    "deny port range",
+			list:    "!*.corp.local:1-1023,*.corp.local",
+			allowed: []string{"app.corp.local:8080"},
+			blocked: []string{"app.corp.local:22"},
+		},
+		{
+			name:    "default allow with port",
+			list:    "!169.254.0.0/16,*:443",
+			allowed: []string{"example.com:443", "10.0.0.1:443", "[2001:db8::1]:443"},
+			blocked: []string{"169.254.169.254:443", "example.com:80"},
+			match:   map[string]string{"example.com:443": "* (443,443)"},
+		},
+		{
+			name:    "explicit default deny",
+			list:    "localhost,!*",
+			allowed: []string{"localhost:80"},
+			blocked: []string{"example.com:80", "127.0.0.1:80"},
+			match:   map[string]string{"example.com:80": "!*"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			wl := NewWhitelist()
+			wl.AddFromString(tc.list)
+
+			for _, addr := range tc.allowed {
+				host, port := splitAddr(t, addr)
+				require.True(t, wl.IsAddrAllowed(host, port), "addr %s should be allowed but it is blocked", addr)
+				require.False(t, wl.Contains(context.Background(), "tcp", addr), "bypass for %s should not be blocked", addr)
+			}
+			for _, addr := range tc.blocked {
+				host, port := splitAddr(t, addr)
+				require.False(t, wl.IsAddrAllowed(host, port), "addr %s should be blocked but it is allowed", addr)
+				require.True(t, wl.Contains(context.Background(), "tcp", addr), "bypass for %s should be blocked", addr)
+			}
+			for addr, want := range tc.match {
+				host, port := splitAddr(t, addr)
+				rule, ok := wl.Match(host, port)
+				require.True(t, ok, "addr %s should match a rule", addr)
+				require.Equal(t, want, rule.String())
+			}
+		})
+	}
+}
+
+func splitAddr(t *testing.T, addr string) (string, int) {
+	host, sport, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(sport)
+	require.NoError(t, err)
+	return host, port
+}
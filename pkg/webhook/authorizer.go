@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/grepplabs/reverse-http/pkg/logger"
+)
+
+const (
+	DefaultTimeout     = 2 * time.Second
+	maxResponseLength  = 64 * 1024
+	maxCacheEntries    = 10000
+	defaultDenyMessage = "denied by authorization webhook"
+)
+
+// Request is sent to the webhook for every client request.
+type Request struct {
+	Subject     string   `json:"subject,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	AgentID     string   `json:"agent_id"`
+	Network     string   `json:"network"`
+	Destination string   `json:"destination"`
+	SourceIP    string   `json:"source_ip,omitempty"`
+}
+
+// Response is the webhook decision, the reason is logged for denied requests.
+type Response struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type AuthorizerOption func(*Authorizer)
+
+func WithTimeout(timeout time.Duration) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.timeout = timeout
+	}
+}
+
+// WithFailOpen allows the requests when the webhook is not reachable or fails.
+func WithFailOpen(failOpen bool) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.failOpen = failOpen
+	}
+}
+
+// WithCacheTTL caches the decisions for the same request, zero disables the cache.
+func WithCacheTTL(ttl time.Duration) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.cacheTTL = ttl
+	}
+}
+
+func WithHttpClient(httpClient *http.Client) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.httpClient = httpClient
+	}
+}
+
+type cacheEntry struct {
+	response  Response
+	expiresAt time.Time
+}
+
+type Authorizer struct {
+	url        string
+	timeout    time.Duration
+	failOpen   bool
+	cacheTTL   time.Duration
+	httpClient *http.Client
+	logger     *logger.Logger
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewAuthorizer creates the authorizer delegating the decisions to the webhook URL.
+func NewAuthorizer(url string, opts ...AuthorizerOption) (*Authorizer, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("webhook: invalid url %q", url)
+	}
+	a := &Authorizer{
+		url:        url,
+		timeout:    DefaultTimeout,
+		httpClient: http.DefaultClient,
+		logger:     logger.GetInstance().WithFields(map[string]any{"kind": "authz-webhook"}),
+		cache:      make(map[string]cacheEntry),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+func (a *Authorizer) Authorize(ctx context.Context, network, addr string, _ ...gost.AuthorizeOption) error {
+	req := Request{
+		AgentID:     string(gost.ClientIDFromContext(ctx)),
+		Network:     network,
+		Destination: addr,
+	}
+	if identity := gost.ClientIdentityFromContext(ctx); identity != nil {
+		req.Subject = identity.Subject
+		req.Groups = identity.Groups
+	}
+	if srcAddr := gost.SrcAddrFromContext(ctx); srcAddr != nil {
+		if host, _, err := net.SplitHostPort(srcAddr.String()); err == nil {
+			req.SourceIP = host
+		}
+	}
+	key := cacheKey(req)
+	resp, ok := a.getCached(key)
+	if !ok {
+		var err error
+		resp, err = a.call(ctx, req)
+		if err != nil {
+			if a.failOpen {
+				a.logger.Warnf("webhook failure, allowing request: %v", err)
+				return nil
+			}
+			return fmt.Errorf("webhook failure: %w", err)
+		}
+		a.setCached(key, resp)
+	}
+	if !resp.Allow {
+		if resp.Reason == "" {
+			return errors.New(defaultDenyMessage)
+		}
+		return fmt.Errorf("%s: %s", defaultDenyMessage, resp.Reason)
+	}
+	return nil
+}
+
+func (a *Authorizer) call(ctx context.Context, request Request) (Response, error) {
+	var response Response
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseLength)).Decode(&response); err != nil {
+		return response, fmt.Errorf("invalid response: %w", err)
+	}
+	return response, nil
+}
+
+func cacheKey(req Request) string {
+	return strings.Join([]string{req.Subject, strings.Join(req.Groups, ","), req.AgentID, req.Network, req.Destination, req.SourceIP}, "\x00")
+}
+
+func (a *Authorizer) getCached(key string) (Response, bool) {
+	if a.cacheTTL <= 0 {
+		return Response{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.cache[key]
+	if !ok {
+		return Response{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(a.cache, key)
+		return Response{}, false
+	}
+	return entry.response, true
+}
+
+func (a *Authorizer) setCached(key string, response Response) {
+	if a.cacheTTL <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if len(a.cache) >= maxCacheEntries {
+		for k, entry := range a.cache {
+			if now.After(entry.expiresAt) {
+				delete(a.cache, k)
+			}
+		}
+		if len(a.cache) >= maxCacheEntries {
+			a.cache = make(map[string]cacheEntry)
+		}
+	}
+	a.cache[key] = cacheEntry{response: response, expiresAt: now.Add(a.cacheTTL)}
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/reverse-http/pkg/gost"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext() context.Context {
+	ctx := gost.ContextWithClientID(context.Background(), "4711")
+	ctx = gost.ContextWithClientIdentity(ctx, &gost.ClientIdentity{Subject: "alice", Groups: []string{"sre"}})
+	return gost.ContextWithSrcAddr(ctx, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53122})
+}
+
+func TestAuthorizer(t *testing.T) {
+	// the handler records the requests, the assertions run in the test goroutine
+	var mu sync.Mutex
+	var requests []Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		resp := Response{Allow: req.Destination == "httpbin.org:443"}
+		if !resp.Allow {
+			resp.Reason = "destination not allowed"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	recorded := func() []Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Request(nil), requests...)
+	}
+
+	a, err := NewAuthorizer(server.URL, WithCacheTTL(time.Minute))
+	require.NoError(t, err)
+
+	require.NoError(t, a.Authorize(testContext(), "tcp", "httpbin.org:443"))
+	err = a.Authorize(testContext(), "tcp", "example.com:443")
+	require.ErrorContains(t, err, "destination not allowed")
+	reqs := recorded()
+	require.Len(t, reqs, 2)
+	for _, req := range reqs {
+		require.Equal(t, "alice", req.Subject)
+		require.Equal(t, []string{"sre"}, req.Groups)
+		require.Equal(t, "4711", req.AgentID)
+		require.Equal(t, "10.0.0.1", req.SourceIP)
+	}
+	require.Equal(t, "httpbin.org:443", reqs[0].Destination)
+	require.Equal(t, "example.com:443", reqs[1].Destination)
+
+	// cached decisions
+	require.NoError(t, a.Authorize(testContext(), "tcp", "httpbin.org:443"))
+	require.Error(t, a.Authorize(testContext(), "tcp", "example.com:443"))
+	require.Len(t, recorded(), 2)
+}
+
+func TestAuthorizerFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(Response{Allow: true})
+	}))
+	defer server.Close()
+
+	failClosed, err := NewAuthorizer(server.URL, WithTimeout(10*time.Millisecond))
+	require.NoError(t, err)
+	require.ErrorContains(t, failClosed.Authorize(testContext(), "tcp", "httpbin.org:443"), "webhook failure")
+
+	failOpen, err := NewAuthorizer(server.URL, WithTimeout(10*time.Millisecond), WithFailOpen(true))
+	require.NoError(t, err)
+	require.NoError(t, failOpen.Authorize(testContext(), "tcp", "httpbin.org:443"))
+}